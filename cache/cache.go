@@ -14,28 +14,140 @@
 
 package cache
 
+import (
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+)
+
 const (
 
-	// defaultShards is the amount of shards in SpearCache
+	// defaultShards is the default amount of shards in SpearCache
 	defaultShards = 256
 
-	// defaultItems is the amount of items in a single shard
+	// defaultItems is the default amount of items in a single shard
 	defaultItems = 1024
 
-	// defaultNoClutter is the amount of items that will always be checked,
-	// to prevent cache cluttering
+	// defaultNoClutter is the minimum amount of items in a shard
 	defaultNoClutter = 8
 )
 
 // SpearCache is a preallocated in memory cache. SpearCache uses a ring queue of a fixed length.
-// All entries in the cache are appended in time order. Entries of the same key don't get updated,
-// but appended instead. When the ring is full, the oldest entries are automatically overwritten.
-// A cache get will retrieve the newest appended entry to the queue, if it exist and is not yet expired.
+// All entries in the cache are kept in time order. A key that is set again is updated and moved to
+// the newest position, and a key that is found by a get is moved to the newest position as well.
+// When the ring is full, the least recently used entries are automatically overwritten.
+// A cache get will retrieve the entry of the key, if it exist and is not yet expired.
+// Entries are found by the hash of their key, and the key is compared as well, so different keys
+// with the same hash never return each other's values.
+//
+// The ring queue of a shard is allocated when the first key of the shard is set.
 type SpearCache struct {
-	shards [defaultShards]*shard
+
+	// stats is the first field, so its counters are aligned for atomic operations
+	stats  Stats
+	shards []*shard
+	mask   uint64
+
+	// calls holds the loaders that are running for GetOrLoad by key, errorTTL is Options.ErrorTTL
+	loadLock sync.Mutex
+	calls    map[string]*call
+	errorTTL time.Duration
+}
+
+// Options holds the sizing of a SpearCache, see NewCacheWithOptions
+type Options struct {
+
+	// Shards is the amount of shards, which is rounded up to a power of two. The default is 256.
+	Shards int
+
+	// ItemsPerShard is the length of the ring queue of a shard. The default is 1024,
+	// and it is at least 8.
+	ItemsPerShard int
+
+	// MaxBytes is the budget for the size of the values in the cache, which is divided over
+	// the shards. When a shard exceeds its part of the budget, its oldest entries are evicted.
+	// The size of a value is reported by Sizer. Zero means there is no budget.
+	MaxBytes int
+
+	// OnEvict is called with the key and value of each item that is removed from the cache,
+	// except for keys that are set again. It is called while the shard of the key is locked,
+	// so it must not use the cache.
+	OnEvict func(key string, value interface{}, reason EvictReason)
+
+	// ErrorTTL is the time errors of loaders are stored by GetOrLoad, so failing loads aren't
+	// repeated for every caller. Zero means errors are not stored.
+	ErrorTTL time.Duration
 }
 
-// NewCache returns an empty SpearCache
+// Sizer is implemented by values that report their size in bytes, which is used for the byte
+// budget of the cache. Values of type []byte and string are sized by their length, other
+// values that don't implement Sizer have a size of zero.
+type Sizer interface {
+	Size() int
+}
+
+// NewCache returns an empty SpearCache, with 256 shards of 1024 items
 func NewCache() *SpearCache {
-	return &SpearCache{}
+	return NewCacheWithOptions(Options{})
+}
+
+// NewCacheWithOptions returns an empty SpearCache sized by opts
+func NewCacheWithOptions(opts Options) *SpearCache {
+
+	shards := defaultShards
+	if opts.Shards > 0 {
+		for shards = 1; shards < opts.Shards; shards <<= 1 {
+		}
+	}
+
+	items := defaultItems
+	if opts.ItemsPerShard > 0 {
+		items = opts.ItemsPerShard
+	}
+	if items < defaultNoClutter {
+		items = defaultNoClutter
+	}
+
+	// Each shard gets an equal part of the budget
+	var maxBytes int
+	if opts.MaxBytes > 0 {
+		maxBytes = (opts.MaxBytes + shards - 1) / shards
+	}
+
+	c := &SpearCache{
+		shards:   make([]*shard, shards),
+		mask:     uint64(shards - 1),
+		errorTTL: opts.ErrorTTL,
+	}
+	for id := range c.shards {
+		c.shards[id] = newShard(items, maxBytes, &c.stats, opts.OnEvict)
+	}
+
+	return c
+}
+
+// hashKey returns the xxhash of key and the id of the shard of key. A zero hash marks unused
+// items, so keys hashing to zero use 1 instead. Items store the key as well, so this doesn't
+// mix up keys.
+func (c *SpearCache) hashKey(key string) (uint64, uint64) {
+	keyHash := xxhash.Sum64([]byte(key))
+	if keyHash == 0 {
+		keyHash = 1
+	}
+	return keyHash, keyHash & c.mask
+}
+
+// sizeOf returns the size of value in bytes, see Sizer
+func sizeOf(value interface{}) int {
+	switch v := value.(type) {
+	case Sizer:
+		return v.Size()
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		return 0
+	}
 }
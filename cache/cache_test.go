@@ -16,7 +16,12 @@ package cache
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -73,6 +78,346 @@ func TestCacheFind(t *testing.T) {
 
 }
 
+func TestCacheTTL(t *testing.T) {
+	c := NewCache()
+
+	c.SetWithTTL("short", 1, 50*time.Millisecond)
+	c.SetWithTTL("long", 2, time.Hour)
+	c.Set("none", 3)
+
+	if ok, val := c.Get("short", 900000000000); !ok || val != 1 {
+		t.Errorf("Key short should not be expired yet, got %v %v", ok, val)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The TTL of the key expires the key, regardless of max age
+	if ok, _ := c.Get("short", 900000000000); ok {
+		t.Errorf("Key short should be expired")
+	}
+	if ok, _, _ := c.Find("short"); ok {
+		t.Errorf("Key short should be expired for Find")
+	}
+	if ok, val := c.Get("long", 900000000000); !ok || val != 2 {
+		t.Errorf("Key long should not be expired, got %v %v", ok, val)
+	}
+	if ok, val := c.Get("none", 900000000000); !ok || val != 3 {
+		t.Errorf("Key none should not be expired, got %v %v", ok, val)
+	}
+
+	// Setting a key again replaces its TTL
+	c.SetWithTTL("short", 4, time.Hour)
+	if ok, val := c.Get("short", 900000000000); !ok || val != 4 {
+		t.Errorf("Key short should be set again, got %v %v", ok, val)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	c := NewCache()
+
+	c.Set("old", 1)
+	time.Sleep(50 * time.Millisecond)
+
+	// Enough newer keys to move the old key out of the clutter window
+	for i, v := range keys {
+		c.Set(v, i)
+	}
+
+	if ok, _ := c.Get("old", 10000000); ok {
+		t.Errorf("Key old should be older than max age")
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	c := NewCache()
+
+	c.Set("/blog/a", 1)
+	c.Set("/blog/b", 2)
+	c.Set("/about", 3)
+
+	// Get moves the key to the cursor, so the key is stored once
+	c.Get("/blog/a", 900000000000)
+
+	if !c.Delete("/about") {
+		t.Errorf("Key /about should be deleted")
+	}
+	if c.Delete("/about") {
+		t.Errorf("Key /about should already be deleted")
+	}
+	if ok, _ := c.Get("/about", 900000000000); ok {
+		t.Errorf("Key /about should not be found after Delete")
+	}
+
+	if n := c.DeletePrefix("/blog/"); n != 2 {
+		t.Errorf("DeletePrefix should delete 2 entries, deleted %d", n)
+	}
+	for _, key := range []string{"/blog/a", "/blog/b"} {
+		if ok, _, _ := c.Find(key); ok {
+			t.Errorf("Key %s should not be found after DeletePrefix", key)
+		}
+	}
+}
+
+func TestCacheCollision(t *testing.T) {
+	c := NewCache()
+
+	c.Set("a", 1)
+
+	// Give the item of a the hash of b, as if the keys collide
+	keyHash, id := c.hashKey("a")
+	collision, collisionID := c.hashKey("b")
+	c.shards[collisionID] = c.shards[id]
+	for i := range c.shards[id].items {
+		if c.shards[id].items[i].key == keyHash {
+			c.shards[id].items[i].key = collision
+		}
+	}
+
+	if ok, val := c.Get("b", 900000000000); ok {
+		t.Errorf("Key b should not return the value of a colliding key, got %v", val)
+	}
+	if ok, val, _ := c.Find("b"); ok {
+		t.Errorf("Key b should not find the value of a colliding key, got %v", val)
+	}
+	if c.Delete("b") {
+		t.Errorf("Key b should not delete a colliding key")
+	}
+
+	// Setting b doesn't update the colliding key
+	c.Set("b", 2)
+	if ok, val := c.Get("b", 900000000000); !ok || val != 2 {
+		t.Errorf("Key b should have value 2, got %v %v", ok, val)
+	}
+}
+
+// sized is a value of size bytes
+type sized int
+
+func (s sized) Size() int {
+	return int(s)
+}
+
+func TestCacheWithOptions(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 3, ItemsPerShard: 16})
+
+	if len(c.shards) != 4 {
+		t.Errorf("Shards should be rounded up to 4, got %d", len(c.shards))
+	}
+
+	// Each shard remembers the 16 newest keys
+	for i := 0; i < 200; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if ok, _, _ := c.Find("0"); ok {
+		t.Errorf("Key 0 should be overwritten")
+	}
+	if ok, val := c.Get("199", 900000000000); !ok || val != 199 {
+		t.Errorf("Key 199 should have value 199, got %v %v", ok, val)
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxBytes: 100})
+
+	c.Set("a", sized(40))
+	c.Set("b", []byte("0123456789012345678901234567890123456789"))
+	c.Set("c", sized(10))
+
+	// a and b are evicted to make room for d
+	c.Set("d", sized(60))
+	for _, key := range []string{"a", "b"} {
+		if ok, _, _ := c.Find(key); ok {
+			t.Errorf("Key %s should be evicted", key)
+		}
+	}
+	for _, key := range []string{"c", "d"} {
+		if ok, _, _ := c.Find(key); !ok {
+			t.Errorf("Key %s should not be evicted", key)
+		}
+	}
+	if c.shards[0].bytes != 70 {
+		t.Errorf("Shard should hold 70 bytes, holds %d", c.shards[0].bytes)
+	}
+
+	// Updating and deleting keys updates the size of the shard
+	c.Set("d", sized(20))
+	c.Delete("c")
+	if c.shards[0].bytes != 20 {
+		t.Errorf("Shard should hold 20 bytes, holds %d", c.shards[0].bytes)
+	}
+}
+
+func TestCacheMaxBytesUpdate(t *testing.T) {
+	c := NewCacheWithOptions(Options{Shards: 1, MaxBytes: 100})
+
+	c.Set("a", sized(30))
+	c.Set("b", sized(30))
+	c.Set("c", sized(30))
+
+	// a is updated in place, which evicts b instead of a itself
+	c.Set("a", sized(50))
+	if ok, val, _ := c.Find("a"); !ok || val != sized(50) {
+		t.Errorf("Key a should have value 50, got %v %v", ok, val)
+	}
+	if ok, _, _ := c.Find("b"); ok {
+		t.Errorf("Key b should be evicted")
+	}
+	if c.shards[0].bytes != 80 {
+		t.Errorf("Shard should hold 80 bytes, holds %d", c.shards[0].bytes)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+
+	evicted := make(map[EvictReason][]string)
+	c := NewCacheWithOptions(Options{
+		Shards:        1,
+		ItemsPerShard: 8,
+		OnEvict: func(key string, value interface{}, reason EvictReason) {
+			evicted[reason] = append(evicted[reason], key)
+		},
+	})
+
+	c.SetWithTTL("expired", 0, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	for i := 1; i <= 9; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.Get("3", 900000000000)
+	c.Get("missing", 900000000000)
+	c.Delete("2")
+
+	stats := c.Stats()
+	want := Stats{Hits: 1, Misses: 1, Sets: 10, Overwritten: 1, Expired: 1, Deleted: 1}
+	want.Scanned = stats.Scanned
+	if stats != want {
+		t.Errorf("Stats should be %+v, got %+v", want, stats)
+	}
+	if stats.Scanned == 0 {
+		t.Errorf("Stats should count scanned items")
+	}
+
+	// 8 overwrites expired and 9 overwrites 1
+	for reason, key := range map[EvictReason]string{EvictExpired: "expired", EvictOverwritten: "1", EvictDeleted: "2"} {
+		if len(evicted[reason]) != 1 || evicted[reason][0] != key {
+			t.Errorf("OnEvict should be called for %s with reason %s, got %v", key, reason, evicted[reason])
+		}
+	}
+
+	// Get moves 3 to the newest position without overwriting another key
+	for i := 3; i <= 9; i++ {
+		if ok, _, _ := c.Find(strconv.Itoa(i)); !ok {
+			t.Errorf("Key %d should not be overwritten", i)
+		}
+	}
+	if len(evicted[EvictOverwritten]) != 1 {
+		t.Errorf("Get should not overwrite keys, got %v", evicted[EvictOverwritten])
+	}
+}
+
+func TestCacheSetAgain(t *testing.T) {
+
+	var evicted []string
+	c := NewCacheWithOptions(Options{
+		Shards:        1,
+		ItemsPerShard: 16,
+		MaxBytes:      1000,
+		OnEvict: func(key string, value interface{}, reason EvictReason) {
+			evicted = append(evicted, fmt.Sprintf("%s=%v %s", key, value, reason))
+		},
+	})
+
+	// a is set again after it left the items that are updated in place, which replaces
+	// the older item of a without calling OnEvict
+	c.Set("a", sized(10))
+	for i := 1; i <= 8; i++ {
+		c.Set(strconv.Itoa(i), sized(1))
+	}
+	c.Set("a", sized(20))
+	if len(evicted) != 0 || c.shards[0].bytes != 28 {
+		t.Errorf("Older item of a should be removed, got %d bytes and evictions %v", c.shards[0].bytes, evicted)
+	}
+
+	// Wrapping around overwrites the items of 1 to 8 and a once
+	for i := 9; i <= 24; i++ {
+		c.Set(strconv.Itoa(i), sized(1))
+	}
+	if stats := c.Stats(); stats.Overwritten != 9 || len(evicted) != 9 || evicted[8] != "a=20 overwritten" {
+		t.Errorf("Overwriting should count 9 items and evict a once, got %d %v", stats.Overwritten, evicted)
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	c := NewCache()
+
+	var loads int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "value", nil
+	}
+
+	// Concurrent callers wait for a single loader
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := c.GetOrLoad("key", time.Hour, loader); val != "value" || err != nil {
+				t.Errorf("GetOrLoad should return value, got %v %v", val, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("Loader should run once, ran %d times", n)
+	}
+	if ok, val := c.Get("key", 900000000000); !ok || val != "value" {
+		t.Errorf("Loaded key should be set, got %v %v", ok, val)
+	}
+}
+
+func TestCacheGetOrLoadError(t *testing.T) {
+
+	errLoad := errors.New("load failed")
+	var loads int
+	loader := func() (interface{}, error) {
+		loads++
+		return nil, errLoad
+	}
+
+	// Without ErrorTTL, errors are not stored
+	c := NewCache()
+	c.GetOrLoad("key", time.Hour, loader)
+	if _, err := c.GetOrLoad("key", time.Hour, loader); err != errLoad || loads != 2 {
+		t.Errorf("Loader should run again after an error, got %v after %d loads", err, loads)
+	}
+
+	// With ErrorTTL, errors are stored, but not returned by Get
+	loads = 0
+	c = NewCacheWithOptions(Options{ErrorTTL: 50 * time.Millisecond})
+	c.GetOrLoad("key", time.Hour, loader)
+	if _, err := c.GetOrLoad("key", time.Hour, loader); err != errLoad || loads != 1 {
+		t.Errorf("Stored error should be returned, got %v after %d loads", err, loads)
+	}
+	if ok, _ := c.Get("key", 900000000000); ok {
+		t.Errorf("Get should not return a stored error")
+	}
+	if hits := c.Stats().Hits; hits != 0 {
+		t.Errorf("Stored errors should count as misses, got %d hits", hits)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	c.GetOrLoad("key", time.Hour, loader)
+	if loads != 2 {
+		t.Errorf("Loader should run again after ErrorTTL, ran %d times", loads)
+	}
+}
+
 func BenchmarkCacheSet(b *testing.B) {
 	cache := NewCache()
 	b.ResetTimer()
@@ -108,6 +453,34 @@ func BenchmarkCacheGet(b *testing.B) {
 	}
 }
 
+// BenchmarkCacheGetHit gets keys that are stored, so each get compares the stored key
+// with the key. Compare with BenchmarkCacheGet.
+func BenchmarkCacheGetHit(b *testing.B) {
+	benchmarkCacheGetHit(b, "")
+}
+
+// BenchmarkCacheGetHitLongKey is like BenchmarkCacheGetHit, with long keys that only
+// differ at the end, which is the worst case to compare keys
+func BenchmarkCacheGetHitLongKey(b *testing.B) {
+	benchmarkCacheGetHit(b, strings.Repeat("/path", 20))
+}
+
+func benchmarkCacheGetHit(b *testing.B, prefix string) {
+	cache := NewCache()
+	stored := make([]string, 4096)
+	var key [8]byte
+	for i := range stored {
+		binary.LittleEndian.PutUint64(key[:], uint64(i))
+		stored[i] = prefix + string(key[:])
+		cache.Set(stored[i], make([]byte, 8))
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cache.Get(stored[i%len(stored)], 1000000000)
+	}
+}
+
 func BenchmarkCacheFind(b *testing.B) {
 	cache := NewCache()
 	var key [8]byte
@@ -122,3 +495,23 @@ func BenchmarkCacheFind(b *testing.B) {
 		cache.Find(string(key[:]))
 	}
 }
+
+// BenchmarkCacheGetSet gets and sets stored keys, like the limiter does for each request.
+// Both move the key to the newest position, which shouldn't depend on how full the shards are.
+func BenchmarkCacheGetSet(b *testing.B) {
+	cache := NewCache()
+	stored := make([]string, defaultShards*defaultItems*3/4)
+	var key [8]byte
+	for i := range stored {
+		binary.LittleEndian.PutUint64(key[:], uint64(i))
+		stored[i] = string(key[:])
+		cache.Set(stored[i], make([]byte, 8))
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		key := stored[i%len(stored)]
+		_, value := cache.Get(key, 1000000000)
+		cache.Set(key, value)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"strings"
+)
+
+// Delete is used to delete a key from the cache. It reports whether the key was stored.
+func (c *SpearCache) Delete(key string) bool {
+
+	// hash the key with xxhash and make the id
+	keyHash, id := c.hashKey(key)
+
+	// Lock the shard for concurrency safetey
+	c.shards[id].lock.Lock()
+
+	itemID, deleted := c.shards[id].position(keyHash, key)
+	if deleted {
+		c.shards[id].evictItem(itemID, EvictDeleted)
+	}
+
+	c.shards[id].lock.Unlock()
+
+	return deleted
+}
+
+// DeletePrefix is used to delete every key starting with prefix from the cache, for example
+// to invalidate the cached responses of a path and its subpaths. It returns the number of
+// entries that were deleted. DeletePrefix searches every shard and is a costly operation.
+func (c *SpearCache) DeletePrefix(prefix string) int {
+
+	var deleted int
+	for id := range c.shards {
+
+		c.shards[id].lock.Lock()
+		for i := range c.shards[id].items {
+			if c.shards[id].items[i].key != 0 && strings.HasPrefix(c.shards[id].items[i].name, prefix) {
+				c.shards[id].evictItem(i, EvictDeleted)
+				deleted++
+			}
+		}
+		c.shards[id].lock.Unlock()
+	}
+
+	return deleted
+}
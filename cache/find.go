@@ -15,67 +15,41 @@
 package cache
 
 import (
+	"math"
 	"time"
-
-	"github.com/cespare/xxhash"
 )
 
 // Find is used to find a key in the cache. It doesn't require a max age as parameter,
-// this means it will search the entire cache. Find is a costly operation and should only be
-// used when necessary. If the key is found it returns true, the value and the age of the key in nano seconds.
-// If the key is not found, false, nil and zero are returned.
+// this means a key is found as long as it is stored and its TTL didn't expire. If the key is found it returns true, the value and the age of the key in nano seconds.
+// If the key is not found or its TTL expired, false, nil and zero are returned.
 func (c *SpearCache) Find(key string) (bool, interface{}, uint64) {
 
 	// hash the key with xxhash and make the id
-	keyHash := xxhash.Sum64([]byte(key))
-	id := keyHash & (defaultShards - 1)
+	keyHash, id := c.hashKey(key)
 
 	// Get current time in nano seconds
 	now := uint64(time.Now().UnixNano())
 
-	// We make sure the shard exists, if it doesn't the key isn't stored
-	if c.shards[id] == nil {
-		return false, nil, 0
-	}
-
 	// Lock the shard for concurrency safetey
 	c.shards[id].lock.Lock()
 
-	rangeEnd := c.shards[id].cursor - defaultItems - 1
-
-	// We range over the ring queue
-	for i := c.shards[id].cursor; i >= rangeEnd; i-- {
-
-		itemID := i
-
-		if itemID < 0 {
-			itemID = itemID + defaultItems
-		}
-		if itemID >= defaultItems {
-			itemID = defaultItems - 1
-		}
-
-		key := c.shards[id].items[itemID].key
-
-		// If the key is empty we continue, this is when the queue is empty at the start
-		if key == 0 {
-			continue
-		}
-
-		// We test if the item is within the maxAge range. If it is not we break.
-		// If it is we check if the key matches the key we search.
-		if key == keyHash {
-
-			// appendKey
-			c.appendKey(key, id, c.shards[id].items[itemID].value)
+	itemID, ok := c.shards[id].lookup(keyHash, key, now, math.MaxUint64)
+	if !ok {
+		c.shards[id].lock.Unlock()
+		return false, nil, 0
+	}
 
-			// Unlock and return
-			c.shards[id].lock.Unlock()
-			return true, c.shards[id].items[itemID].value, now - c.shards[id].items[itemID].modTime
-		}
+	// Errors stored by GetOrLoad are not returned
+	if _, isErr := c.shards[id].items[itemID].value.(*loadError); isErr {
+		c.shards[id].lock.Unlock()
+		return false, nil, 0
 	}
 
-	c.shards[id].lock.Unlock()
+	// The item is moved to the newest position, without overwriting another item
+	it := c.shards[id].items[itemID]
+	c.shards[id].refresh(itemID)
 
-	return false, nil, 0
+	// Unlock and return
+	c.shards[id].lock.Unlock()
+	return true, it.value, now - it.modTime
 }
@@ -16,70 +16,39 @@ package cache
 
 import (
 	"time"
-
-	"github.com/cespare/xxhash"
 )
 
 // Get is used to retrieve a key from the cache. Get requires the key and the max age
 // of the key in nano seconds. If the key is found true and the value are returned.
-// If the key is not found or is expired, false and nil are returned
+// If the key is not found, is older than max age or its TTL expired, false and nil are returned
 func (c *SpearCache) Get(key string, maxAge uint64) (bool, interface{}) {
 
 	// hash the key with xxhash and make the id
-	keyHash := xxhash.Sum64([]byte(key))
-	id := keyHash & (defaultShards - 1)
+	keyHash, id := c.hashKey(key)
 
 	// Get current time in nano seconds
 	now := uint64(time.Now().UnixNano())
 
-	// We make sure the shard exists, if it doesn't the key isn't stored
-	if c.shards[id] == nil {
-		return false, nil
-	}
-
 	// Lock the shard for concurrency safetey
 	c.shards[id].lock.Lock()
 
-	rangeEnd := c.shards[id].cursor - defaultItems - 1
-	var itemsParsed int
-
-	// We range over the ring queue
-	for i := c.shards[id].cursor; i >= rangeEnd; i-- {
-		itemsParsed++
-		itemID := i
-
-		if itemID < 0 {
-			itemID = itemID + defaultItems
-		}
-		if itemID >= defaultItems {
-			itemID = defaultItems - 1
-		}
-
-		key := c.shards[id].items[itemID].key
-
-		// If the key is empty we continue, this is when the queue is empty at the start
-		if key == 0 {
-			continue
-		}
-
-		if now-c.shards[id].items[itemID].modTime > maxAge && itemsParsed < defaultNoClutter {
-			break
-		}
-
-		// We test if the item is within the maxAge range. If it is not we break.
-		// If it is we check if the key matches the key we search.
-		if key == keyHash {
-
-			// appendKey
-			c.appendKey(key, id, c.shards[id].items[itemID].value)
+	itemID, ok := c.shards[id].lookup(keyHash, key, now, maxAge)
+	if !ok {
+		c.shards[id].lock.Unlock()
+		return false, nil
+	}
 
-			// Unlock and return
-			c.shards[id].lock.Unlock()
-			return true, c.shards[id].items[itemID].value
-		}
+	// Errors stored by GetOrLoad are not returned
+	if _, isErr := c.shards[id].items[itemID].value.(*loadError); isErr {
+		c.shards[id].lock.Unlock()
+		return false, nil
 	}
 
-	c.shards[id].lock.Unlock()
+	// The item is moved to the newest position, without overwriting another item
+	it := c.shards[id].items[itemID]
+	c.shards[id].refresh(itemID)
 
-	return false, nil
+	// Unlock and return
+	c.shards[id].lock.Unlock()
+	return true, it.value
 }
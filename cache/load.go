@@ -0,0 +1,120 @@
+// Copyright 2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrLoaderPanicked is returned by GetOrLoad to the callers waiting for a loader that panicked
+var ErrLoaderPanicked = errors.New("cache: loader panicked")
+
+// call is a loader that is running for a key. The callers waiting for the loader
+// wait until done is closed, and then return value and err.
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// loadError is stored instead of a value when a loader fails, see Options.ErrorTTL
+type loadError struct {
+	err error
+}
+
+// GetOrLoad returns the value of key. If the key is not stored, the value is loaded with loader
+// and set with ttl, like SetWithTTL. The loader runs once at a time for a key, callers that get the
+// key while it is loading wait for the loader and get its result. If the loader returns an error,
+// the error is returned and nothing is stored, unless Options.ErrorTTL is set. Then the error is
+// stored for ErrorTTL, and returned by GetOrLoad without running the loader. Get and Find don't
+// return stored errors.
+func (c *SpearCache) GetOrLoad(key string, ttl time.Duration, loader func() (interface{}, error)) (interface{}, error) {
+
+	if ok, value, err := c.getLoaded(key); ok {
+		return value, err
+	}
+
+	c.loadLock.Lock()
+
+	// Wait for the loader that is running for key
+	if cl, ok := c.calls[key]; ok {
+		c.loadLock.Unlock()
+		<-cl.done
+		return cl.value, cl.err
+	}
+
+	// The key can be set by a loader that finished after the first get. Loaders set the
+	// key before they are removed from calls, so checking again here is enough.
+	if ok, value, err := c.getLoaded(key); ok {
+		c.loadLock.Unlock()
+		return value, err
+	}
+
+	if c.calls == nil {
+		c.calls = make(map[string]*call)
+	}
+	cl := &call{done: make(chan struct{}), err: ErrLoaderPanicked}
+	c.calls[key] = cl
+	c.loadLock.Unlock()
+
+	// The waiting callers are released, even if the loader panics
+	defer func() {
+		c.loadLock.Lock()
+		delete(c.calls, key)
+		c.loadLock.Unlock()
+		close(cl.done)
+	}()
+
+	value, err := loader()
+	switch {
+	case err == nil:
+		c.SetWithTTL(key, value, ttl)
+	case c.errorTTL > 0:
+		c.SetWithTTL(key, &loadError{err: err}, c.errorTTL)
+	}
+
+	cl.value, cl.err = value, err
+	return value, err
+}
+
+// getLoaded gets key for GetOrLoad. It reports whether the key is stored, and returns
+// the value, or the stored error of the loader.
+func (c *SpearCache) getLoaded(key string) (bool, interface{}, error) {
+
+	keyHash, id := c.hashKey(key)
+	now := uint64(time.Now().UnixNano())
+
+	c.shards[id].lock.Lock()
+
+	// Keys loaded by GetOrLoad expire by their TTL, so the max age isn't limited
+	itemID, ok := c.shards[id].lookup(keyHash, key, now, math.MaxUint64)
+	if !ok {
+		c.shards[id].lock.Unlock()
+		return false, nil, nil
+	}
+
+	// The item is moved to the newest position, without overwriting another item
+	it := c.shards[id].items[itemID]
+	c.shards[id].refresh(itemID)
+
+	c.shards[id].lock.Unlock()
+
+	if le, ok := it.value.(*loadError); ok {
+		return true, nil, le.err
+	}
+	return true, it.value, nil
+}
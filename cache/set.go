@@ -15,76 +15,102 @@
 package cache
 
 import (
+	"sync/atomic"
 	"time"
-
-	"github.com/cespare/xxhash"
 )
 
 // Set is used to set a key value pair into SpearCache
 // The key should always be a string. The value can be everything.
+// The key value pair doesn't expire, use SetWithTTL to set an expiry.
 func (c *SpearCache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL is used to set a key value pair into SpearCache, that expires after ttl.
+// Get and Find don't return the key once it expired, regardless of the max age used to get it.
+// If ttl is zero or lower, the key value pair doesn't expire.
+func (c *SpearCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
 
 	// hash the key with xxhash and make the id
-	keyHash := xxhash.Sum64([]byte(key))
-	id := keyHash & (defaultShards - 1)
+	keyHash, id := c.hashKey(key)
 
-	// We make sure the shard exists, if it doesn't we create one
-	if c.shards[id] == nil {
-		c.shards[id] = newShard()
+	now := uint64(time.Now().UnixNano())
+	var expires uint64
+	if ttl > 0 {
+		expires = now + uint64(ttl)
 	}
 
+	atomic.AddUint64(&c.stats.Sets, 1)
+
 	// Lock the shard for concurrency safety. We don't use defer to unlock the shard (on purpose)
 	c.shards[id].lock.Lock()
 
-	// To prevent cache cluttering we check if the previous 10 entries are equal to key
-	// If the key exists in the previous defaultNoClutter entries before cursor, we update that key instead
-	// of appending the key value to the cache.
-	for i := 1; i < defaultNoClutter; i++ {
-
-		itemID := c.shards[id].cursor - i
-
-		if itemID < 0 {
-			itemID = itemID + defaultItems
-		}
-
-		// If the key exists we update the value and modtime.
-		if c.shards[id].items[itemID].key == keyHash {
+	// We make sure the ring queue of the shard exists, if it doesn't we allocate it
+	if c.shards[id].items == nil {
+		c.shards[id].items = make([]item, c.shards[id].length)
+		c.shards[id].index = make(map[string]int, c.shards[id].length)
+	}
 
-			c.shards[id].items[itemID].value = value
-			c.shards[id].items[itemID].modTime = uint64(time.Now().UnixNano())
+	// The size of values is only needed for the byte budget
+	var size int
+	if c.shards[id].maxBytes > 0 {
+		size = sizeOf(value)
+	}
 
-			// Unlock and return
-			c.shards[id].lock.Unlock()
-			return
-		}
+	// If the key exists we update the value, modtime and expiry instead of appending the key value
+	// to the cache. The item is moved to the newest position, so it isn't evicted to make room
+	// for its own value.
+	if itemID, ok := c.shards[id].position(keyHash, key); ok {
+
+		c.shards[id].bytes += size - c.shards[id].items[itemID].size
+		c.shards[id].items[itemID].value = value
+		c.shards[id].items[itemID].size = size
+		c.shards[id].items[itemID].modTime = now
+		c.shards[id].items[itemID].expires = expires
+		c.shards[id].promote(itemID)
+		c.shards[id].evict()
+
+		// Unlock and return
+		c.shards[id].lock.Unlock()
+		return
 	}
 
-	// appendKey, it couldn't be updated.
-	c.appendKey(keyHash, id, value)
+	// appendKey, the key isn't stored yet.
+	c.appendKey(id, item{
+		key:     keyHash,
+		name:    key,
+		value:   value,
+		size:    size,
+		expires: expires,
+	})
 
 	// We unlock the shard
 	c.shards[id].lock.Unlock()
 }
 
-// appendKey is used to append a key to the cache. This is called by both
-// set and get commands. This should only be called when a shard is already unlocked.
-func (c *SpearCache) appendKey(keyHash uint64, id uint64, value interface{}) {
+// appendKey is used to append an item to the cache, with the current time as modification time.
+// This is called by set commands. This should only be called when a shard is already locked.
+func (c *SpearCache) appendKey(id uint64, it item) {
 
-	// if the cursor of the queue is longer than defaultItems - 1, the cursor is reset to zero
-	if c.shards[id].cursor > defaultItems-1 {
+	// if the cursor of the queue is longer than the queue - 1, the cursor is reset to zero
+	if c.shards[id].cursor > len(c.shards[id].items)-1 {
 		c.shards[id].cursor = 0
 	}
 
-	// Key value pairs are appended to the cache. SpearCache only updates an existing key
-	// if that key is maximally defaultNoClutter entries removed from the cursor. This is to prevent
-	// cache cluttering. This makes SpearCache set commands very fast.
-	// A cache get will always retrieve the latest key value, if the key exists and is not yet expired.
-	c.shards[id].items[c.shards[id].cursor] = item{
-		key:     keyHash,
-		value:   value,
-		modTime: uint64(time.Now().UnixNano()),
+	// Keys that aren't stored yet are appended to the cache. The item at the cursor, which is
+	// the least recently used item, is overwritten, and older items are evicted if the shard
+	// exceeds its budget.
+	it.modTime = uint64(time.Now().UnixNano())
+	reason := EvictOverwritten
+	if c.shards[id].items[c.shards[id].cursor].expired(it.modTime) {
+		reason = EvictExpired
 	}
+	c.shards[id].evictItem(c.shards[id].cursor, reason)
+	c.shards[id].items[c.shards[id].cursor] = it
+	c.shards[id].index[it.name] = c.shards[id].cursor
+	c.shards[id].bytes += it.size
 
 	// We increase the cursor
 	c.shards[id].cursor++
+	c.shards[id].evict()
 }
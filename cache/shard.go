@@ -16,24 +16,169 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // SpearCache is divided into shards. This allows multiple go routines to access,
 // read and write the cache concurrently while not being limited by a single lock.
 type shard struct {
-	lock   sync.Mutex
-	items  [defaultItems]item
+	lock sync.Mutex
+
+	// items is the ring queue, which is allocated with length items when the first key is set
+	items  []item
+	length int
 	cursor int
+
+	// index holds the position of the item of each key, so keys are found without
+	// searching the ring queue
+	index map[string]int
+
+	// bytes is the size of the values in the shard, maxBytes the budget of the shard
+	bytes    int
+	maxBytes int
+
+	// stats are the statistics of the cache, onEvict is called for removed items
+	stats   *Stats
+	onEvict func(key string, value interface{}, reason EvictReason)
 }
 
-// Each shard contains an array (yes array not slice) of item.
+// Each shard contains a ring queue of item. Items are looked up by the hash
+// of their key, and name holds the key itself, so keys with the same hash are told apart.
+// An item with an empty key is unused or deleted.
 type item struct {
 	modTime uint64
+	expires uint64
 	key     uint64
+	name    string
 	value   interface{}
+	size    int
+}
+
+// newShard returns an empty pointer to a shard with a ring queue of length items
+// and a budget of maxBytes, that counts in stats and calls onEvict for removed items
+func newShard(length, maxBytes int, stats *Stats, onEvict func(string, interface{}, EvictReason)) *shard {
+	return &shard{length: length, maxBytes: maxBytes, stats: stats, onEvict: onEvict}
+}
+
+// expired reports whether the item is expired at now. Items without a TTL never expire.
+func (it *item) expired(now uint64) bool {
+	return it.expires != 0 && now >= it.expires
+}
+
+// matches reports whether the item holds key, with hash keyHash
+func (it *item) matches(keyHash uint64, key string) bool {
+	return it.key == keyHash && it.name == key
+}
+
+// lookup returns the position of the item of key in the shard. If the item is expired or older
+// than maxAge nano seconds, the key is not found. Errors stored by GetOrLoad are found, but counted
+// as a miss. The shard must be locked.
+func (s *shard) lookup(keyHash uint64, key string, now, maxAge uint64) (int, bool) {
+
+	itemID, ok := s.position(keyHash, key)
+	if ok {
+		it := &s.items[itemID]
+		ok = !(now > it.modTime && now-it.modTime > maxAge) && !it.expired(now)
+	}
+
+	hit := ok
+	if ok {
+		_, isErr := s.items[itemID].value.(*loadError)
+		hit = !isErr
+	}
+	if hit {
+		atomic.AddUint64(&s.stats.Hits, 1)
+		atomic.AddUint64(&s.stats.Scanned, uint64(s.distance(itemID)))
+	} else {
+		atomic.AddUint64(&s.stats.Misses, 1)
+	}
+
+	return itemID, ok
+}
+
+// position returns the position of the item of key in the shard. The shard must be locked.
+func (s *shard) position(keyHash uint64, key string) (int, bool) {
+	itemID, ok := s.index[key]
+	if !ok || !s.items[itemID].matches(keyHash, key) {
+		return 0, false
+	}
+	return itemID, true
 }
 
-// newShard returns an empty pointer to a shard
-func newShard() *shard {
-	return &shard{}
+// distance returns the distance of the item at itemID to the cursor. The newest item has
+// distance 1, the item at the cursor, which is overwritten next, has the length of the ring queue.
+func (s *shard) distance(itemID int) int {
+	return ((s.cursor-1-itemID)%len(s.items)+len(s.items))%len(s.items) + 1
+}
+
+// remove removes the item at itemID from the shard. The shard must be locked.
+func (s *shard) remove(itemID int) {
+	if it := &s.items[itemID]; it.key != 0 {
+		if pos, ok := s.index[it.name]; ok && pos == itemID {
+			delete(s.index, it.name)
+		}
+	}
+	s.bytes -= s.items[itemID].size
+	s.items[itemID] = item{}
+}
+
+// promote moves the item at itemID to the newest position, at the cursor. The item at the cursor,
+// which would be overwritten next, takes the old position of the item instead of being overwritten.
+// The shard must be locked.
+func (s *shard) promote(itemID int) {
+
+	// if the cursor of the queue is longer than the queue - 1, the cursor is reset to zero
+	if s.cursor > len(s.items)-1 {
+		s.cursor = 0
+	}
+
+	// The newest item is just before the cursor
+	if itemID == (s.cursor+len(s.items)-1)%len(s.items) {
+		return
+	}
+
+	s.items[itemID], s.items[s.cursor] = s.items[s.cursor], s.items[itemID]
+	if s.items[itemID].key != 0 {
+		s.index[s.items[itemID].name] = itemID
+	}
+	s.index[s.items[s.cursor].name] = s.cursor
+	s.cursor++
+}
+
+// refresh makes the item at itemID the newest item of the shard, with the current time
+// as modification time. The shard must be locked.
+func (s *shard) refresh(itemID int) {
+	s.items[itemID].modTime = uint64(time.Now().UnixNano())
+	s.promote(itemID)
+}
+
+// evictItem removes the item at itemID from the shard for reason, if the item is used.
+// The shard must be locked.
+func (s *shard) evictItem(itemID int, reason EvictReason) {
+
+	it := s.items[itemID]
+	if it.key == 0 {
+		return
+	}
+
+	s.remove(itemID)
+	s.stats.count(reason)
+	if s.onEvict != nil {
+		s.onEvict(it.name, it.value, reason)
+	}
+}
+
+// evict removes the oldest items from the shard, until the values in the shard fit in the budget
+// of the shard. The newest item is never evicted. The shard must be locked.
+func (s *shard) evict() {
+
+	if s.maxBytes == 0 {
+		return
+	}
+
+	// The items at and after the cursor are the least recently used items
+	for n := 0; s.bytes > s.maxBytes && n < len(s.items)-1; n++ {
+		s.evictItem((s.cursor+n)%len(s.items), EvictBudget)
+	}
 }
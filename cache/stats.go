@@ -0,0 +1,110 @@
+// Copyright 2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// Stats holds the statistics of a SpearCache, see SpearCache.Stats
+type Stats struct {
+
+	// Hits and Misses count the keys that were found and not found by Get, Find and GetOrLoad.
+	// Errors stored by GetOrLoad count as misses.
+	Hits   uint64
+	Misses uint64
+
+	// Scanned sums the distance of the hits of Get, Find and GetOrLoad to the newest item
+	// of the ring queue. Divided by Hits, it is the average distance to a key.
+	Scanned uint64
+
+	// Sets counts the key value pairs that were set
+	Sets uint64
+
+	// Overwritten counts the items that were overwritten before they expired, because the
+	// ring queue wrapped around. Expired counts the overwritten items that were expired.
+	// Items without a TTL never expire, so overwriting them is counted as Overwritten.
+	Overwritten uint64
+	Expired     uint64
+
+	// Evicted counts the items that were evicted to stay within the byte budget
+	Evicted uint64
+
+	// Deleted counts the items that were deleted by Delete and DeletePrefix
+	Deleted uint64
+}
+
+// EvictReason is the reason an item is removed from the cache, see Options.OnEvict
+type EvictReason int
+
+const (
+
+	// EvictOverwritten means the item was overwritten before it expired, because the ring queue wrapped around
+	EvictOverwritten EvictReason = iota + 1
+
+	// EvictExpired means the item was overwritten after it expired
+	EvictExpired
+
+	// EvictBudget means the item was evicted to stay within the byte budget
+	EvictBudget
+
+	// EvictDeleted means the item was deleted by Delete or DeletePrefix
+	EvictDeleted
+)
+
+// String returns the name of the reason
+func (r EvictReason) String() string {
+	switch r {
+	case EvictOverwritten:
+		return "overwritten"
+	case EvictExpired:
+		return "expired"
+	case EvictBudget:
+		return "budget"
+	case EvictDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats returns the statistics of the cache. The counters are updated atomically, so Stats
+// can be called while the cache is used.
+func (c *SpearCache) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.stats.Hits),
+		Misses:      atomic.LoadUint64(&c.stats.Misses),
+		Scanned:     atomic.LoadUint64(&c.stats.Scanned),
+		Sets:        atomic.LoadUint64(&c.stats.Sets),
+		Overwritten: atomic.LoadUint64(&c.stats.Overwritten),
+		Expired:     atomic.LoadUint64(&c.stats.Expired),
+		Evicted:     atomic.LoadUint64(&c.stats.Evicted),
+		Deleted:     atomic.LoadUint64(&c.stats.Deleted),
+	}
+}
+
+// count adds the item that is removed for reason to the statistics
+func (s *Stats) count(reason EvictReason) {
+	switch reason {
+	case EvictOverwritten:
+		atomic.AddUint64(&s.Overwritten, 1)
+	case EvictExpired:
+		atomic.AddUint64(&s.Expired, 1)
+	case EvictBudget:
+		atomic.AddUint64(&s.Evicted, 1)
+	case EvictDeleted:
+		atomic.AddUint64(&s.Deleted, 1)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/redmaner/MaguroHTTP/tuna"
+)
+
+// checkConfig checks the configuration and the configurations of its vhosts and prints every
+// error and warning. It exits with status 1 if the configuration has errors, so it can be used
+// to check a configuration before the server is restarted.
+func checkConfig(config string) {
+
+	r := tuna.CheckConfig(config)
+
+	for _, err := range r.Errors {
+		fmt.Printf("error: %v\n", err)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Printf("warning: %v\n", warning)
+	}
+
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", config, len(r.Errors), len(r.Warnings))
+
+	if len(r.Errors) > 0 {
+		os.Exit(1)
+	}
+}
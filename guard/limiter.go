@@ -33,8 +33,14 @@ type Limiter struct {
 
 // NewLimiter returns a new guard.Limiter
 func NewLimiter(ratePerMin float64, rateBurst int, filterIP bool) *Limiter {
+	return NewLimiterWithCache(ratePerMin, rateBurst, filterIP, cache.NewCache())
+}
+
+// NewLimiterWithCache is like NewLimiter, but the limiter remembers clients in cache c,
+// which can be sized with cache.NewCacheWithOptions
+func NewLimiterWithCache(ratePerMin float64, rateBurst int, filterIP bool, c *cache.SpearCache) *Limiter {
 	return &Limiter{
-		cache:      cache.NewCache(),
+		cache:      c,
 		RatePerSec: rate.Limit(ratePerMin / 60.00),
 		RateBurst:  rateBurst,
 		ErrorHandler: router.ErrorHandler(func(w http.ResponseWriter, r *http.Request, code int) {
@@ -47,6 +53,11 @@ func NewLimiter(ratePerMin float64, rateBurst int, filterIP bool) *Limiter {
 	}
 }
 
+// Stats returns the statistics of the cache in which the limiter remembers clients
+func (l *Limiter) Stats() cache.Stats {
+	return l.cache.Stats()
+}
+
 // LimitHTTP is a HTTP middleware function that can be used to add rate limiting
 // to HTTP handlers.
 func (l *Limiter) LimitHTTP(h http.HandlerFunc) http.HandlerFunc {
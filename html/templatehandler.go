@@ -27,6 +27,7 @@ import (
 // initialise and execute template more easily.
 type TemplateHandler struct {
 	init sync.Once
+	err  error
 	Tpl  *template.Template
 	name string
 	dir  string
@@ -43,15 +44,47 @@ func NewTemplate(dir string, name string) *TemplateHandler {
 
 // Init is used to initialise the HTML template. It can be called on multiple locations
 // Init uses sync.Once to make sure it is only executed once.
+// Init exits the program if the template cannot be loaded, use TryInit to handle the error instead.
 func (t *TemplateHandler) Init() {
+	if err := t.TryInit(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// TryInit is like Init, but returns a *TemplateError if the template cannot be loaded.
+// The error is returned by every call of TryInit.
+func (t *TemplateHandler) TryInit() error {
 	t.init.Do(func() {
-		if _, err := os.Stat(t.dir + t.name); err == nil {
-			t.Tpl = template.Must(template.ParseFiles(t.dir + t.name))
-		} else {
-			fmt.Printf("TemplateHandler: Error loading %s%s\n", t.dir, t.name)
-			os.Exit(1)
+		if _, err := os.Stat(t.dir + t.name); err != nil {
+			t.err = &TemplateError{File: t.dir + t.name, Err: err}
+			return
 		}
+
+		tpl, err := template.ParseFiles(t.dir + t.name)
+		if err != nil {
+			t.err = &TemplateError{File: t.dir + t.name, Err: err}
+			return
+		}
+		t.Tpl = tpl
 	})
+	return t.err
+}
+
+// TemplateError is the error returned by TryInit, holding the template file that failed to load
+type TemplateError struct {
+	File string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *TemplateError) Error() string {
+	return "TemplateHandler: Error loading " + e.File + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *TemplateError) Unwrap() error {
+	return e.Err
 }
 
 // Execute is a wrapper function to easily execute the template
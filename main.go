@@ -16,7 +16,9 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"syscall"
 
 	"github.com/redmaner/MaguroHTTP/tuna"
 )
@@ -26,13 +28,38 @@ func main() {
 
 	if len(args) <= 1 {
 		showHelp(args)
+		os.Exit(1)
 	}
 
-	m := tuna.NewInstanceFromConfig(args[1])
-	m.Serve()
-
+	switch args[1] {
+	case "routes":
+		if len(args) <= 2 {
+			showHelp(args)
+			os.Exit(1)
+		}
+		showRoutes(args[2], args[3:])
+	case "check":
+		if len(args) != 3 {
+			showHelp(args)
+			os.Exit(1)
+		}
+		checkConfig(args[2])
+	default:
+		m, err := tuna.New(
+			tuna.WithConfigFile(args[1]),
+			tuna.WithSignals(syscall.SIGINT, syscall.SIGTERM),
+			tuna.WithReloadSignals(syscall.SIGHUP),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Serve()
+	}
 }
 
 func showHelp(args []string) {
-	fmt.Printf("MaguroHTTP version %s\n\nUsage:\n\n\t%s /path/to/config.json\n\n", tuna.Version, args[0])
+	fmt.Printf("MaguroHTTP version %s\n\nUsage:\n\n", tuna.Version)
+	fmt.Printf("\t%s /path/to/config.json\n", args[0])
+	fmt.Printf("\t%s check /path/to/config.json\n", args[0])
+	fmt.Printf("\t%s routes /path/to/config.json [host path [method [Content-Type [Accept]]]]\n\n", args[0])
 }
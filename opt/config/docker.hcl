@@ -1,10 +1,15 @@
 
+# Configurations can be split over multiple files with Include, which takes
+# a path or a pattern relative to this file, for example:
+# Include = ["vhosts.d/*.hcl"]
+
 # Core configuration
+# ${NAME:-default} is replaced by the environment variable NAME, or by default if NAME is not set
 Core {
-	Address = "0.0.0.0"
-	Port = "80"
+	Address = "${MAGURO_ADDRESS:-0.0.0.0}"
+	Port = "${MAGURO_PORT:-80}"
 
-	LogLevel = "3"
+	LogLevel = "${MAGURO_LOGLEVEL:-3}"
 	LogOut = "stdout"
 
 	FileDir = "/usr/lib/microhttp/"
@@ -21,6 +26,7 @@ Core {
 		Enabled = true
 		Path = "/MicroMetrics"
 		Out = "/usr/lib/microhttp/metrics.json"
+		# Secrets can be read from mounted files with ${file("/path/to/secret")}
 		Users {
 			"Admin" = "Your amazing passphrase goes here, because passphrases are the way to go"
 		}
@@ -90,3 +96,15 @@ Guard {
 	Rate = 100
 	RateBurst = 10
 }
+
+# Vhosts can be declared inline. With Inherit, a vhost starts from the settings above
+# and only overrides what it sets.
+# Requests for hosts that match no vhost or alias are served by Core.DefaultVhost, or
+# answered as configured by Core.UnknownHost, for example UnknownHost { Status = 421 }.
+# Vhost "example.com" {
+#	Inherit = true
+#	Aliases = ["www.example.com"]
+#	Serve {
+#		ServeDir = "/var/www/example.com/"
+#	}
+# }
@@ -0,0 +1,122 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"testing"
+)
+
+// benchRoutes is the amount of routes registered for each benchmark
+const benchRoutes = 5000
+
+// mapRouter is the map and path.Dir based route matching that was used
+// by SRouter before the radix tree. It is kept for comparison.
+type mapRouter struct {
+	routes map[string]pathRoute
+}
+
+func (mr *mapRouter) matchRoute(host, urlPath string) (bool, bool, pathRoute) {
+
+	if route, ok := mr.routes[host+urlPath]; ok {
+		return true, true, route
+	}
+
+	for pa := urlPath; pa != "/"; pa = path.Dir(pa) {
+		if route, ok := mr.routes[host+pa]; ok {
+			return true, false, route
+		}
+	}
+
+	if route, ok := mr.routes[host+"/"]; ok {
+		return true, false, route
+	}
+
+	return false, false, pathRoute{}
+}
+
+// benchPaths returns benchRoutes paths spread over several levels
+func benchPaths() []string {
+	paths := make([]string, 0, benchRoutes)
+	for i := 0; len(paths) < benchRoutes; i++ {
+		paths = append(paths,
+			fmt.Sprintf("/api/v%d", i),
+			fmt.Sprintf("/api/v%d/resource%d", i%10, i),
+			fmt.Sprintf("/api/v%d/resource%d/items", i%10, i),
+			fmt.Sprintf("/static/%d/assets/file%d.css", i%25, i),
+		)
+	}
+	return append(paths[:benchRoutes-1], "/")
+}
+
+func newBenchMapRouter() *mapRouter {
+	mr := &mapRouter{routes: make(map[string]pathRoute)}
+	for _, p := range benchPaths() {
+		mr.routes[DefaultHost+p] = pathRoute{subRoutes: make(map[string]methodRoute)}
+	}
+	return mr
+}
+
+func newBenchRouter() *SRouter {
+	sr := NewRouter()
+	for _, p := range benchPaths() {
+		sr.AddRoute(DefaultHost, p, true, "GET", "*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	return sr
+}
+
+var benchRequests = map[string]string{
+	"Exact":    "/api/v3/resource1203/items",
+	"Fallback": "/api/v3/resource1203/items/42/details",
+	"Root":     "/unknown/path/to/a/resource",
+}
+
+func BenchmarkMatchRouteTree(b *testing.B) {
+	sr := newBenchRouter()
+	for name, p := range benchRequests {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sr.matchRoute(DefaultHost, p)
+			}
+		})
+	}
+}
+
+func BenchmarkMatchRouteMap(b *testing.B) {
+	mr := newBenchMapRouter()
+	for name, p := range benchRequests {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mr.matchRoute(DefaultHost, p)
+			}
+		})
+	}
+}
+
+func BenchmarkGetRoute(b *testing.B) {
+	sr := newBenchRouter()
+	for name, p := range benchRequests {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sr.getRoute(nil, "127.0.0.1", p, "GET", "", "")
+			}
+		})
+	}
+}
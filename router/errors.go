@@ -0,0 +1,69 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import "errors"
+
+// Errors returned by the registration functions of the router, wrapped in a RouteError.
+// They can be tested with errors.Is.
+var (
+	ErrBlankParameter     = errors.New("found illegal blank parameters")
+	ErrInvalidPath        = errors.New("path contains an invalid parameter")
+	ErrNoLeadingSlash     = errors.New("path must begin with a slash")
+	ErrInvalidHost        = errors.New("host is not a valid host pattern")
+	ErrInvalidMethod      = errors.New("method is not a valid HTTP method")
+	ErrMethodNotAllowed   = errors.New("method is not allowed")
+	ErrNilHandler         = errors.New("nil handler")
+	ErrInvalidContentType = errors.New("invalid Content-Type")
+	ErrInvalidMediaType   = errors.New("invalid media type")
+	ErrPathConflict       = errors.New("path conflicts with a parameter of an existing route")
+	ErrRouteNotFound      = errors.New("route doesn't exist")
+	ErrRouteExists        = errors.New("route already exists")
+	ErrRedirectCode       = errors.New("redirect code must be 301 or 308")
+)
+
+// RouteError is the error returned by the registration functions of the router. It holds
+// the operation and the host, path and method it was called with, if any.
+type RouteError struct {
+	Op     string
+	Host   string
+	Path   string
+	Method string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *RouteError) Error() string {
+	s := "router: " + e.Op
+	for _, v := range []string{e.Host, e.Path, e.Method} {
+		if v != "" {
+			s += " " + v
+		}
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, one of the Err variables of this package
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// routeError wraps err in a RouteError. It returns nil if err is nil.
+func routeError(op, host, path, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RouteError{Op: op, Host: host, Path: path, Method: method, Err: err}
+}
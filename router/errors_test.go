@@ -0,0 +1,73 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRouteErrors(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/users/:id", false, "GET", "", paramHandler("user"))
+
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{ro.TryAddRoute("", "/", false, "GET", "", paramHandler("x")), ErrBlankParameter},
+		{ro.TryAddRoute(DefaultHost, "/files/*rest/x", false, "GET", "", paramHandler("x")), ErrInvalidPath},
+		{ro.TryAddRoute("*.*example.com", "/", false, "GET", "", paramHandler("x")), ErrInvalidHost},
+		{ro.TryAddRoute(DefaultHost, "/", false, "PURGE", "", paramHandler("x")), ErrMethodNotAllowed},
+		{ro.TryAddRoute(DefaultHost, "/", false, "GET", "", nil), ErrNilHandler},
+		{ro.TryAddRoute(DefaultHost, "/", false, "GET", "text", paramHandler("x")), ErrInvalidContentType},
+		{ro.TryAddRoute(DefaultHost, "/users/:name", false, "GET", "", paramHandler("x")), ErrPathConflict},
+		{ro.TryUseMiddleware(DefaultHost, "/users/:name", namedMiddleware("x")), ErrPathConflict},
+		{ro.TryUseMethodMiddleware(DefaultHost, "/users/:id", "POST", namedMiddleware("x")), ErrRouteNotFound},
+		{ro.TryUseHostMiddleware(DefaultHost, nil), ErrNilHandler},
+		{ro.TrySetProduces(DefaultHost, "/users/:id", "GET", "text/*"), ErrInvalidMediaType},
+		{ro.TryRegisterMethod("PUR GE"), ErrInvalidMethod},
+		{ro.TrySetNormalizePolicy(DefaultHost, NormalizePolicy{RedirectCode: 302}), ErrRedirectCode},
+		{ro.TryMount(DefaultHost, "/sub", nil), ErrNilHandler},
+		{ro.TryAddRoute(DefaultHost, "users", false, "GET", "", paramHandler("x")), ErrNoLeadingSlash},
+		{ro.TryUseMiddleware(DefaultHost, "users", namedMiddleware("x")), ErrNoLeadingSlash},
+		{ro.TryMount(DefaultHost, "sub", paramHandler("x")), ErrNoLeadingSlash},
+		{tryGroupErr(ro.TryGroup("", "/api")), ErrBlankParameter},
+		{tryGroupErr(ro.TryGroup(DefaultHost, "api")), ErrNoLeadingSlash},
+		{tryGroupErr(ro.Group(DefaultHost, "/api").TryGroup("v1")), ErrNoLeadingSlash},
+	}
+
+	for i, test := range tests {
+		var re *RouteError
+		if !errors.As(test.err, &re) || !errors.Is(test.err, test.want) {
+			t.Errorf("%d: expected a RouteError wrapping %v, got %v", i, test.want, test.err)
+		}
+	}
+
+	err := ro.TryAddRoute(DefaultHost, "/", false, "PURGE", "", paramHandler("x"))
+	if want := "router: AddRoute DEFAULT / PURGE: method is not allowed"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+
+	if err := ro.TryAddRoute(DefaultHost, "/", false, "GET", "", paramHandler("root")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// tryGroupErr returns the error of a TryGroup call
+func tryGroupErr(_ *RouteGroup, err error) error {
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Route describes a route registered with AddRoute. Middleware holds the names of
+// the middleware executed for the route, in order of execution.
+type Route struct {
+	Host       string
+	Path       string
+	Method     string
+	Content    string
+	Produces   string
+	Fallback   bool
+	Predicates []string
+	Middleware []string
+}
+
+// RouteExplanation describes how the router would handle a request
+type RouteExplanation struct {
+
+	// Status is the status code the router would return. A status of 200
+	// means the request would be dispatched to the handler of Route.
+	Status int
+
+	// Host and Path are the host and path of the path route that matched the request.
+	// They are empty if no path route matched.
+	Host string
+	Path string
+
+	// Methods holds the methods registered for the matched path route
+	Methods []string
+
+	// Route is the method route that matched the request. It is nil if no
+	// method route matched the request method.
+	Route *Route
+
+	// Fallback is true if the path route matched through fallback to a parent path or the root path
+	Fallback bool
+
+	// Params holds the parameters captured from the host and path
+	Params RouteParams
+
+	// MediaType is the media type negotiated with the Accept header, if the
+	// method route declares the media types it produces.
+	MediaType string
+
+	// Location is the canonical path the client would be redirected to, if the normalization
+	// policy of the matched route redirects requests for paths that aren't canonical
+	Location string
+
+	// Middleware holds the names of the middleware that would be executed, in order of execution.
+	// This includes global, host and path middleware, and method middleware if a method route matched.
+	Middleware []string
+}
+
+// Routes calls fn for each route registered in the router, ordered by host, path and method.
+// Routes with predicates precede the route without predicates of the same method, in order of registration.
+// If fn returns false, the iteration stops. Routes iterates over a snapshot of the routes,
+// so fn can safely use the router.
+func (sr *SRouter) Routes(fn func(Route) bool) {
+
+	sr.mu.RLock()
+
+	var routes []Route
+	for _, tree := range sr.trees {
+		tree.walk(func(pr *pathRoute) {
+			for _, mr := range pr.subRoutes {
+				for _, v := range mr.variants {
+					routes = append(routes, newRoute(pr, v))
+				}
+				if mr.handler != nil {
+					routes = append(routes, newRoute(pr, mr))
+				}
+			}
+		})
+	}
+
+	sr.mu.RUnlock()
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		switch {
+		case routes[i].Host != routes[j].Host:
+			return routes[i].Host < routes[j].Host
+		case routes[i].Path != routes[j].Path:
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	for _, rt := range routes {
+		if !fn(rt) {
+			return
+		}
+	}
+}
+
+// Explain explains how the router would handle a request with the given host, path,
+// method, Content-Type and Accept header, without dispatching it to a handler. The path
+// can contain a query string, which is used to evaluate query predicates. The path is
+// normalized according to the normalization policy of the matched route, like ServeHTTP does.
+func (sr *SRouter) Explain(host, path, method, contentType, accept string) RouteExplanation {
+
+	r := &http.Request{Method: method, Host: host, URL: &url.URL{Path: path}, Header: make(http.Header)}
+	if u, err := url.Parse(path); err == nil {
+		r.URL = u
+	}
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("Accept", accept)
+
+	requested := r.URL.EscapedPath()
+	path = cleanPath(r.URL.Path)
+	match := sr.getRoute(r, StripHostPort(host), path, method, contentType, accept)
+
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	// Requests for a path that isn't canonical can be redirected or rejected
+	status := match.status
+	var location string
+	if status == 200 {
+		var canonical string
+		canonical, status = sr.normalization(match, path, requested)
+		if status != 200 && status != 404 {
+			location = (&url.URL{Path: canonical}).EscapedPath()
+		}
+	}
+
+	explanation := RouteExplanation{
+		Status:    status,
+		Location:  location,
+		Host:      match.pathRoute.host,
+		Path:      match.pathRoute.path,
+		Fallback:  match.pathRoute.subRoutes != nil && !match.exact,
+		Params:    match.params,
+		MediaType: match.mediaType,
+	}
+
+	for mtd := range match.pathRoute.subRoutes {
+		explanation.Methods = append(explanation.Methods, mtd)
+	}
+	sort.Strings(explanation.Methods)
+
+	explanation.Middleware = middlewareNames(match.pathRoute.chain)
+
+	if match.methodRoute.handler != nil {
+		rt := newRoute(&match.pathRoute, match.methodRoute)
+		explanation.Route = &rt
+		explanation.Middleware = rt.Middleware
+	}
+
+	return explanation
+}
+
+// walk calls fn for each pathRoute in the tree
+func (n *node) walk(fn func(*pathRoute)) {
+	if n.route != nil {
+		fn(n.route)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	if n.param != nil {
+		n.param.walk(fn)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(fn)
+	}
+}
+
+// newRoute returns the Route describing a methodRoute of pathRoute pr
+func newRoute(pr *pathRoute, mr methodRoute) Route {
+	return Route{
+		Host:       pr.host,
+		Path:       pr.path,
+		Method:     mr.method,
+		Content:    mr.content,
+		Produces:   strings.Join(mr.produces, ";"),
+		Predicates: predicateNames(mr.predicates),
+		Fallback:   mr.pathFallback,
+		Middleware: middlewareNames(mr.stack),
+	}
+}
+
+// predicateNames returns the predicates formatted by Predicate.String
+func predicateNames(predicates []Predicate) []string {
+	var names []string
+	for _, p := range predicates {
+		names = append(names, p.String())
+	}
+	return names
+}
+
+// middlewareNames returns a readable name for each middleware. Middleware defined as
+// function, like MiddlewareHandlerFunc, is named after the wrapped function.
+func middlewareNames(middleware []Middleware) []string {
+
+	names := make([]string, 0, len(middleware))
+
+	for _, mw := range middleware {
+		name := fmt.Sprintf("%T", mw)
+
+		if v := reflect.ValueOf(mw); v.Kind() == reflect.Func {
+			if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+				name = strings.TrimSuffix(fn.Name(), "-fm")
+			}
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
@@ -0,0 +1,134 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/b", false, "GET", "", exampleHandler())
+	ro.AddRoute(DefaultHost, "/a", false, "POST", "", exampleHandler())
+	ro.AddRoute(DefaultHost, "/a", false, "GET", "", exampleHandler())
+	ro.AddRoute("127.0.0.1", "/users/:id", false, "GET", "", exampleHandler())
+	ro.UseMiddleware(DefaultHost, "/middleware/only", MiddlewareHandlerFunc(exampleMiddleware))
+
+	var got []string
+	ro.Routes(func(rt Route) bool {
+		got = append(got, rt.Host+" "+rt.Path+" "+rt.Method)
+		return true
+	})
+
+	expected := []string{"127.0.0.1 /users/:id GET", "DEFAULT /a GET", "DEFAULT /a POST", "DEFAULT /b GET"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected routes %v, got %v", expected, got)
+	}
+
+	var count int
+	ro.Routes(func(rt Route) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("iteration should stop when fn returns false, got %d calls", count)
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", true, "GET", "", exampleHandler())
+	ro.AddRoute(DefaultHost, "/api", false, "POST", "application/json", exampleHandler())
+	ro.AddRoute(DefaultHost, "/users/:id", false, "GET", "", exampleHandler())
+	ro.UseMiddleware(DefaultHost, "/", MiddlewareHandlerFunc(exampleMiddleware))
+
+	tests := []struct {
+		path     string
+		method   string
+		content  string
+		status   int
+		route    string
+		fallback bool
+	}{
+		{"/", "GET", "", 200, "/", false},
+		{"/unknown", "GET", "", 200, "/", true},
+		{"/api", "GET", "", 405, "/api", false},
+		{"/api", "POST", "text/html", 406, "/api", false},
+		{"/api/sub", "POST", "application/json", 404, "/api", true},
+		{"/users/42", "GET", "", 200, "/users/:id", false},
+	}
+
+	for _, test := range tests {
+		e := ro.Explain("localhost:8080", test.path, test.method, test.content, "")
+		if e.Status != test.status || e.Path != test.route || e.Fallback != test.fallback {
+			t.Errorf("%s %s: expected %d %s fallback=%t, got %d %s fallback=%t", test.method, test.path,
+				test.status, test.route, test.fallback, e.Status, e.Path, e.Fallback)
+		}
+	}
+
+	e := ro.Explain("localhost", "/", "GET", "", "")
+	if len(e.Middleware) != 1 || !strings.HasSuffix(e.Middleware[0], "exampleMiddleware") {
+		t.Errorf("expected exampleMiddleware, got %v", e.Middleware)
+	}
+
+	e = ro.Explain("localhost", "/users/42", "GET", "", "")
+	if id := e.Params.Get("id"); id != "42" {
+		t.Errorf("expected parameter id=42, got %q", id)
+	}
+}
+
+func TestExplainNormalize(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/docs", false, "GET", "", exampleHandler())
+	ro.AddRoute("reject.example.com", "/docs", false, "GET", "", exampleHandler())
+	ro.SetNormalizePolicy(DefaultHost, NormalizePolicy{
+		Action:          NormalizeRedirect,
+		RedirectCode:    308,
+		TrailingSlash:   TrailingSlashStrip,
+		CaseInsensitive: true,
+	})
+	ro.SetNormalizePolicy("reject.example.com", NormalizePolicy{Action: NormalizeReject, TrailingSlash: TrailingSlashAdd})
+
+	tests := []struct {
+		host     string
+		path     string
+		status   int
+		location string
+	}{
+		{"localhost", "/docs", 200, ""},
+		{"localhost", "/docs/", 308, "/docs"},
+		{"localhost", "/DOCS", 308, "/docs"},
+		{"localhost", "//a/../docs", 308, "/docs"},
+		{"reject.example.com", "/docs/", 200, ""},
+		{"reject.example.com", "/docs", 404, ""},
+	}
+
+	for _, test := range tests {
+		e := ro.Explain(test.host, test.path, "GET", "", "")
+		if e.Status != test.status || e.Location != test.location || e.Path != "/docs" {
+			t.Errorf("%s%s: expected %d %q on /docs, got %d %q on %s", test.host, test.path,
+				test.status, test.location, e.Status, e.Location, e.Path)
+		}
+
+		// Explain agrees with ServeHTTP
+		if status, _ := serveStatus(ro, test.host, test.path, "GET"); status != test.status {
+			t.Errorf("%s%s: ServeHTTP responded %d, Explain explained %d", test.host, test.path, status, test.status)
+		}
+	}
+}
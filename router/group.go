@@ -0,0 +1,284 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RouteGroup registers routes below a common path prefix of a single host. Middleware added
+// to a group only applies to the routes registered through the group, or one of its subgroups.
+// Group middleware is executed after path middleware and before method middleware, the middleware
+// of a parent group before the middleware of its subgroups.
+type RouteGroup struct {
+	router     *SRouter
+	parent     *RouteGroup
+	host       string
+	prefix     string
+	middleware []Middleware
+}
+
+// Group returns a RouteGroup registering routes for host below path prefix. For example,
+// a route /users added to the group of /api/v1 is registered as /api/v1/users.
+// The prefix can contain parameters, like any other path.
+// Group panics if host or prefix is invalid, use TryGroup to handle the error instead.
+func (sr *SRouter) Group(host, prefix string) *RouteGroup {
+	g, err := sr.TryGroup(host, prefix)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// TryGroup is like Group, but returns a *RouteError if host or prefix is invalid
+func (sr *SRouter) TryGroup(host, prefix string) (*RouteGroup, error) {
+	if err := groupPrefix(host, prefix); err != nil {
+		return nil, routeError("Group", host, prefix, "", err)
+	}
+
+	return &RouteGroup{
+		router: sr,
+		host:   host,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}, nil
+}
+
+// Group returns a subgroup of g, registering routes below path prefix of g. Middleware of g
+// applies to the routes of the subgroup as well.
+// Group panics if prefix is invalid, use TryGroup to handle the error instead.
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	sub, err := g.TryGroup(prefix)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// TryGroup is like Group, but returns a *RouteError if prefix is invalid
+func (g *RouteGroup) TryGroup(prefix string) (*RouteGroup, error) {
+	if err := groupPrefix(g.host, prefix); err != nil {
+		return nil, routeError("Group", g.host, g.prefix+prefix, "", err)
+	}
+
+	return &RouteGroup{
+		router: g.router,
+		parent: g,
+		host:   g.host,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+	}, nil
+}
+
+// groupPrefix checks the host and path prefix of a group
+func groupPrefix(host, prefix string) error {
+
+	// We don't want empty parameters
+	if host == "" || prefix == "" {
+		return ErrBlankParameter
+	}
+
+	if prefix[0] != '/' {
+		return ErrNoLeadingSlash
+	}
+
+	return nil
+}
+
+// Prefix returns the complete path prefix of the group
+func (g *RouteGroup) Prefix() string {
+	if g.prefix == "" {
+		return "/"
+	}
+	return g.prefix
+}
+
+// path returns the complete path of path p in the group
+func (g *RouteGroup) path(p string) string {
+	if p == "" || p == "/" {
+		return g.Prefix()
+	}
+	return g.prefix + p
+}
+
+// AddRoute adds a route to the group. The path is relative to the prefix of the group,
+// the path / registers the prefix itself. All other parameters are the same as SRouter.AddRoute.
+// AddRoute calls log.Fatal if the route is invalid, use TryAddRoute to handle the error instead.
+func (g *RouteGroup) AddRoute(path string, fallback bool, method, content string, handler http.Handler) {
+	if err := g.TryAddRoute(path, fallback, method, content, handler); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryAddRoute is like AddRoute, but returns a *RouteError if the route is invalid
+func (g *RouteGroup) TryAddRoute(path string, fallback bool, method, content string, handler http.Handler) error {
+
+	g.router.mu.Lock()
+	defer g.router.mu.Unlock()
+
+	return routeError("AddRoute", g.host, g.path(path), method, g.router.addRoute(g.host, g.path(path), fallback, method, content, handler, g))
+}
+
+// UseMiddleware adds Middleware to all routes of the group, including routes already registered.
+// It panics if handler is nil, use TryUseMiddleware to handle the error instead.
+func (g *RouteGroup) UseMiddleware(handler Middleware) {
+	if err := g.TryUseMiddleware(handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryUseMiddleware is like UseMiddleware, but returns a *RouteError if handler is nil
+func (g *RouteGroup) TryUseMiddleware(handler Middleware) error {
+
+	g.router.mu.Lock()
+	defer g.router.mu.Unlock()
+
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return routeError("UseMiddleware", g.host, g.Prefix(), "", ErrNilHandler)
+	}
+
+	g.middleware = append(g.middleware, handler)
+
+	if tree, ok := g.router.trees[g.host]; ok {
+		tree.walk(g.router.composeRoute)
+	}
+
+	return nil
+}
+
+// Mount dispatches requests for path prefix of the group to handler. See SRouter.Mount.
+// Mount calls log.Fatal if the mount is invalid, use TryMount to handle the error instead.
+func (g *RouteGroup) Mount(prefix string, handler http.Handler) {
+	if err := g.TryMount(prefix, handler); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryMount is like Mount, but returns a *RouteError if the mount is invalid
+func (g *RouteGroup) TryMount(prefix string, handler http.Handler) error {
+
+	g.router.mu.Lock()
+	defer g.router.mu.Unlock()
+
+	return routeError("Mount", g.host, g.path(prefix), "", g.router.mount(g.host, g.path(prefix), handler, g))
+}
+
+// stack returns the middleware of g and its parents, in order of execution.
+// The stack of a nil group is empty. This should only be called when the router is already locked.
+func (g *RouteGroup) stack() []Middleware {
+	if g == nil {
+		return nil
+	}
+	return append(g.parent.stack(), g.middleware...)
+}
+
+// Mount dispatches all requests for path prefix of host, and paths below it, to handler. The prefix
+// is stripped from the request path before it is passed to handler, so handler can be an SRouter
+// with routes relative to the prefix. Route parameters captured by the router remain available to
+// handler. Routes registered in the router below the prefix take precedence over the mount.
+// Mounting at a prefix that already has a route for one of the methods fails with ErrRouteExists.
+//
+// The mount is registered as a fallback route for each method allowed by the router at the time
+// of mounting, including registered custom methods, with any Content-Type, so method and
+// Content-Type are left to handler.
+//
+// Mount calls log.Fatal if the mount is invalid, use TryMount to handle the error instead.
+func (sr *SRouter) Mount(host, prefix string, handler http.Handler) {
+	if err := sr.TryMount(host, prefix, handler); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryMount is like Mount, but returns a *RouteError if the mount is invalid
+func (sr *SRouter) TryMount(host, prefix string, handler http.Handler) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	return routeError("Mount", host, prefix, "", sr.mount(host, prefix, handler, nil))
+}
+
+// mount registers handler at prefix of host as part of route group g.
+// This should only be called when the router is already locked.
+func (sr *SRouter) mount(host, prefix string, handler http.Handler, g *RouteGroup) error {
+
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return ErrNilHandler
+	}
+
+	if prefix != "" && prefix[0] != '/' {
+		return ErrNoLeadingSlash
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	strip := stripPrefix(prefix, handler)
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	methods := sr.allowedMethodNames()
+	if pr := sr.findPathRoute(host, prefix); pr != nil {
+		for _, mtd := range methods {
+			if _, ok := pr.subRoutes[mtd]; ok {
+				return ErrRouteExists
+			}
+		}
+	}
+
+	for _, mtd := range methods {
+		if err := sr.addRoute(host, prefix, true, mtd, "*", strip, g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stripPrefix returns a handler stripping the number of segments of prefix from
+// the request path, before dispatching the request to handler. Segments are counted
+// instead of compared, because the prefix can contain parameters.
+func stripPrefix(prefix string, handler http.Handler) http.Handler {
+
+	segments := strings.Count(prefix, "/")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		path := r.URL.Path
+		for i := 0; i < segments && path != ""; i++ {
+			next := strings.IndexByte(path[1:], '/')
+			if next < 0 {
+				path = ""
+				break
+			}
+			path = path[next+1:]
+		}
+
+		if path == "" {
+			path = "/"
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+
+		handler.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+
+	ro := NewRouter()
+	ro.UseHostMiddleware(DefaultHost, namedMiddleware("host"))
+
+	api := ro.Group(DefaultHost, "/api/v1/")
+	api.AddRoute("/", false, "GET", "", paramHandler("index"))
+	api.UseMiddleware(namedMiddleware("api"))
+	api.AddRoute("/users/:id", false, "GET", "", paramHandler("user"))
+
+	admin := api.Group("/admin")
+	admin.UseMiddleware(namedMiddleware("admin"))
+	admin.AddRoute("/stats", false, "GET", "", paramHandler("stats"))
+	ro.UseMiddleware(DefaultHost, "/api/v1/admin/stats", namedMiddleware("path"))
+
+	ro.AddRoute(DefaultHost, "/other", false, "GET", "", paramHandler("other"))
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/api/v1", "host,api,index"},
+		{"/api/v1/users/42", "host,api,user id=42"},
+		{"/api/v1/admin/stats", "host,path,api,admin,stats"},
+		{"/other", "host,other"},
+	}
+
+	for _, test := range tests {
+		if status, body := serveStatus(ro, "localhost", test.path, "GET"); status != 200 || body != test.body {
+			t.Errorf("%s: expected 200 %q, got %d %q", test.path, test.body, status, body)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+
+	sub := NewRouter()
+	sub.AddRoute(DefaultHost, "/", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "sub root %s", r.URL.Path)
+	}))
+	sub.AddRoute(DefaultHost, "/items/:item", false, "DELETE", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s/%s", Param(r, "tenant"), Param(r, "item"))
+	}))
+
+	ro := NewRouter()
+	ro.Mount(DefaultHost, "/shop/:tenant/", sub)
+	ro.AddRoute(DefaultHost, "/shop/:tenant/about", false, "GET", "", paramHandler("about"))
+	ro.Group(DefaultHost, "/static").Mount("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+
+	tests := []struct {
+		path   string
+		method string
+		status int
+		body   string
+	}{
+		{"/shop/acme", "GET", 200, "sub root /"},
+		{"/shop/acme/items/7", "DELETE", 200, "acme/7"},
+		{"/shop/acme/items/7", "GET", 405, ""},
+		{"/shop/acme/about", "GET", 200, "about tenant=acme"},
+		{"/static/css/site.css", "GET", 200, "/css/site.css"},
+		{"/unknown", "GET", 404, ""},
+	}
+
+	for _, test := range tests {
+		status, body := serveStatus(ro, "localhost", test.path, test.method)
+		if status != test.status || status == 200 && body != test.body {
+			t.Errorf("%s %s: expected %d %q, got %d %q", test.method, test.path, test.status, test.body, status, body)
+		}
+	}
+}
+
+func TestMountConflict(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/api", false, "GET", "", paramHandler("api"))
+
+	if err := ro.TryMount(DefaultHost, "/api", paramHandler("sub")); !errors.Is(err, ErrRouteExists) {
+		t.Errorf("expected %v, got %v", ErrRouteExists, err)
+	}
+
+	if status, body := serveStatus(ro, "localhost", "/api", "GET"); status != 200 || body != "api" {
+		t.Errorf("expected 200 %q, got %d %q", "api", status, body)
+	}
+
+	if status, _ := serveStatus(ro, "localhost", "/api/users", "GET"); status != 404 {
+		t.Errorf("expected 404 below the failed mount, got %d", status)
+	}
+}
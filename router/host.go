@@ -0,0 +1,187 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeHostKey is the context key under which the host set with WithRouteHost is stored
+type routeHostKey struct{}
+
+// WithRouteHost returns a shallow copy of r that the router routes as host, instead of the Host
+// of the request. This allows routing requests for a host as another host, like an alias of a
+// virtual host, while handlers and middleware still see the Host the client sent.
+func WithRouteHost(r *http.Request, host string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeHostKey{}, host))
+}
+
+// RouteHost returns the host request r is routed as: the host set with WithRouteHost,
+// or else the Host of the request without port.
+func RouteHost(r *http.Request) string {
+	if host, ok := r.Context().Value(routeHostKey{}).(string); ok {
+		return host
+	}
+	return StripHostPort(r.Host)
+}
+
+// IsHostPattern reports whether host is a host pattern. A host pattern contains
+// labels that match any single label of a request host: a wildcard label (*.example.com)
+// or a named label ({tenant}.api.example.com). Named labels are captured and can be retrieved
+// by handlers with router.Param, in the same way as path parameters.
+func IsHostPattern(host string) bool {
+	return strings.ContainsAny(host, "*{}")
+}
+
+// hostKey returns the key under which the routes, middleware and normalization policy of host are
+// stored. Host names are case insensitive, so hosts are stored in lower case. Host patterns are kept
+// as is, because the names of their labels are case sensitive, and are matched case insensitive.
+func hostKey(host string) string {
+	if host == DefaultHost || IsHostPattern(host) {
+		return host
+	}
+	return strings.ToLower(host)
+}
+
+// MatchHost reports whether host matches host pattern. Labels are compared case insensitive.
+func MatchHost(pattern, host string) bool {
+	return matchHostPattern(pattern, host, nil)
+}
+
+// HostPrecedes reports whether host pattern a takes precedence over host pattern b,
+// when both match the same host. Patterns with more static labels take precedence, for
+// example {tenant}.api.example.com over *.*.example.com. Patterns with the same amount
+// of static labels are ordered alphabetically.
+func HostPrecedes(a, b string) bool {
+	sa, sb := staticLabels(a), staticLabels(b)
+	if sa != sb {
+		return sa > sb
+	}
+	return a < b
+}
+
+// validHostPattern reports whether a host pattern is well formed. Each label must be
+// a wildcard, a named label or a static label.
+func validHostPattern(pattern string) bool {
+	for _, label := range strings.Split(pattern, ".") {
+		switch {
+		case label == "*":
+		case isNamedLabel(label):
+			if strings.ContainsAny(label[1:len(label)-1], "*{}") {
+				return false
+			}
+		case label == "" || strings.ContainsAny(label, "*{}"):
+			return false
+		}
+	}
+	return true
+}
+
+// isNamedLabel reports whether a label of a host pattern is a named label
+func isNamedLabel(label string) bool {
+	return len(label) > 2 && label[0] == '{' && label[len(label)-1] == '}'
+}
+
+// staticLabels returns the amount of static labels in a host pattern
+func staticLabels(pattern string) int {
+	var n int
+	for _, label := range strings.Split(pattern, ".") {
+		if label != "*" && !isNamedLabel(label) {
+			n++
+		}
+	}
+	return n
+}
+
+// matchHostPattern matches host against a host pattern label by label. If params
+// is not nil, named labels are appended to it.
+func matchHostPattern(pattern, host string, params *RouteParams) bool {
+
+	for {
+		pi := strings.IndexByte(pattern, '.')
+		hi := strings.IndexByte(host, '.')
+
+		pl, hl := pattern, host
+		if pi > -1 {
+			pl = pattern[:pi]
+		}
+		if hi > -1 {
+			hl = host[:hi]
+		}
+
+		switch {
+		case pl == "*":
+			if hl == "" {
+				return false
+			}
+		case isNamedLabel(pl):
+			if hl == "" {
+				return false
+			}
+			if params != nil {
+				*params = append(*params, RouteParam{Key: pl[1 : len(pl)-1], Value: hl})
+			}
+		case !strings.EqualFold(pl, hl):
+			return false
+		}
+
+		// Both the pattern and host need to run out of labels at the same time
+		if pi < 0 || hi < 0 {
+			return pi < 0 && hi < 0
+		}
+
+		pattern, host = pattern[pi+1:], host[hi+1:]
+	}
+}
+
+// addHostPattern registers a host pattern, keeping the host patterns sorted by precedence.
+// This should only be called when the router is already locked.
+func (sr *SRouter) addHostPattern(pattern string) {
+	sr.hostPatterns = append(sr.hostPatterns, pattern)
+	sort.Slice(sr.hostPatterns, func(i, j int) bool {
+		return HostPrecedes(sr.hostPatterns[i], sr.hostPatterns[j])
+	})
+}
+
+// Function to match a route for the host of a request. Routes of the exact host take
+// precedence over routes of host patterns. Labels captured by a host pattern precede
+// the captured path parameters. A host that is written as a host pattern only matches
+// host patterns, so it can't match the routes of the pattern itself.
+func (sr *SRouter) matchHost(host, urlPath string) (bool, bool, pathRoute, RouteParams) {
+
+	host = strings.ToLower(host)
+	if !IsHostPattern(host) {
+		if found, exact, route, params := sr.matchRoute(host, urlPath); found {
+			return found, exact, route, params
+		}
+	}
+
+	for _, pattern := range sr.hostPatterns {
+
+		var labels RouteParams
+		if !matchHostPattern(pattern, host, &labels) {
+			continue
+		}
+
+		if found, exact, route, params := sr.matchRoute(pattern, urlPath); found {
+			return found, exact, route, append(labels, params...)
+		}
+	}
+
+	return false, false, pathRoute{}, nil
+}
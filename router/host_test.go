@@ -0,0 +1,121 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		match   bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "WWW.Example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.b.example.com", false},
+		{"{tenant}.api.example.com", "acme.api.example.com", true},
+		{"{tenant}.api.example.com", "acme.www.example.com", false},
+		{"*.*.example.com", "a.b.example.com", true},
+	}
+
+	for _, test := range tests {
+		if MatchHost(test.pattern, test.host) != test.match {
+			t.Errorf("%s for %s: expected %t", test.pattern, test.host, test.match)
+		}
+	}
+}
+
+func TestValidHostPattern(t *testing.T) {
+	for _, p := range []string{"*.example.com", "{tenant}.example.com", "{a}.{b}.example.com"} {
+		if !validHostPattern(p) {
+			t.Errorf("%s should be valid", p)
+		}
+	}
+	for _, p := range []string{"w*.example.com", "{}.example.com", "{a.example.com", "*..example.com"} {
+		if validHostPattern(p) {
+			t.Errorf("%s should be invalid", p)
+		}
+	}
+}
+
+func TestHostPatternRoutes(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute("www.example.com", "/", false, "GET", "", paramHandler("exact"))
+	ro.AddRoute("*.example.com", "/", false, "GET", "", paramHandler("wildcard"))
+	ro.AddRoute("Docs.Example.com", "/", false, "GET", "", paramHandler("docs"))
+	ro.AddRoute("{tenant}.api.example.com", "/users/:id", false, "GET", "", paramHandler("tenant"))
+	ro.AddRoute("*.*.example.com", "/users/:id", false, "GET", "", paramHandler("double"))
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", paramHandler("default"))
+
+	tests := []struct {
+		host string
+		path string
+		body string
+	}{
+		{"www.example.com", "/", "exact"},
+		{"blog.example.com", "/", "wildcard"},
+		{"example.org", "/", "default"},
+		{"acme.api.example.com:8080", "/users/42", "tenant tenant=acme id=42"},
+		{"acme.www.example.com", "/users/42", "double id=42"},
+
+		// Hosts are matched case insensitive
+		{"WWW.Example.com", "/", "exact"},
+		{"docs.example.com", "/", "docs"},
+		{"ACME.api.example.com", "/users/42", "tenant tenant=acme id=42"},
+
+		// A host written as a pattern doesn't match the routes of the pattern itself
+		{"{tenant}.api.example.com", "/users/42", "tenant tenant={tenant} id=42"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %s", err)
+		}
+		req.Host = test.host
+		ro.ServeHTTP(w, req)
+
+		if w.Body.String() != test.body {
+			t.Errorf("%s%s: expected %q, got %q", test.host, test.path, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestRouteHost(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute("www.example.com", "/", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + RouteHost(r)))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "alias.example.com:8080"
+	if host := RouteHost(req); host != "alias.example.com" {
+		t.Errorf("expected alias.example.com, got %s", host)
+	}
+
+	w := httptest.NewRecorder()
+	ro.ServeHTTP(w, WithRouteHost(req, "www.example.com"))
+	if body := w.Body.String(); body != "alias.example.com:8080 www.example.com" {
+		t.Errorf("expected the request to keep its Host, got %q", body)
+	}
+}
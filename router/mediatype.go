@@ -0,0 +1,133 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+// MediaRange is a parsed media type, which can be used as a rule matching other media types.
+// The type and subtype can be a wildcard (*/*, application/*), and the subtype can be a wildcard
+// with a structured syntax suffix (application/*+json), matching any subtype with that suffix.
+// Parameters of a MediaRange are constraints: a media type only matches if it has the
+// same parameters, compared case insensitive. Other parameters of the media type are ignored.
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+}
+
+// ParseMediaRange parses a media type, like application/json or multipart/form-data; boundary=abc.
+// Type, subtype and parameter names are converted to lower case.
+func ParseMediaRange(s string) (MediaRange, error) {
+
+	mt, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return MediaRange{}, err
+	}
+
+	i := strings.IndexByte(mt, '/')
+	if i < 1 || i == len(mt)-1 {
+		return MediaRange{}, errors.New("router: media type " + s + " has no subtype")
+	}
+
+	m := MediaRange{
+		Type:    mt[:i],
+		Subtype: mt[i+1:],
+		Params:  params,
+	}
+
+	// Wildcards can only be used as the complete type or subtype, or as subtype with a suffix
+	switch {
+	case m.Type == "*" && m.Subtype != "*":
+		return MediaRange{}, errors.New("router: media type " + s + " has a wildcard type with a specific subtype")
+	case strings.Contains(m.Type, "*") && m.Type != "*":
+		return MediaRange{}, errors.New("router: media type " + s + " has an invalid wildcard")
+	case strings.Contains(m.Subtype, "*") && m.Subtype != "*" && !(strings.HasPrefix(m.Subtype, "*+") && !strings.Contains(m.Subtype[1:], "*")):
+		return MediaRange{}, errors.New("router: media type " + s + " has an invalid wildcard")
+	}
+
+	return m, nil
+}
+
+// String returns the media range formatted as media type
+func (m MediaRange) String() string {
+	return mime.FormatMediaType(m.Type+"/"+m.Subtype, m.Params)
+}
+
+// IsWildcard reports whether the type or subtype of the media range is a wildcard
+func (m MediaRange) IsWildcard() bool {
+	return m.Type == "*" || strings.HasPrefix(m.Subtype, "*")
+}
+
+// Match reports whether media type mt matches the media range
+func (m MediaRange) Match(mt MediaRange) bool {
+
+	if m.Type != "*" && m.Type != mt.Type {
+		return false
+	}
+
+	switch {
+	case m.Subtype == "*":
+	case strings.HasPrefix(m.Subtype, "*+"):
+		if len(mt.Subtype) < len(m.Subtype) || !strings.HasSuffix(mt.Subtype, m.Subtype[1:]) {
+			return false
+		}
+	case m.Subtype != mt.Subtype:
+		return false
+	}
+
+	for key, value := range m.Params {
+		if v, ok := mt.Params[key]; !ok || !strings.EqualFold(v, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseContentRules parses the Content-Type rules of a method route. Rules are separated by
+// semicolon, segments containing a "=" are parameters of the preceding rule. For example
+// "application/*+json;multipart/form-data;boundary=abc". An empty rule matches an empty Content-Type,
+// it is returned as a MediaRange without type.
+func parseContentRules(content string) ([]MediaRange, error) {
+
+	var rules []string
+	for _, seg := range strings.Split(content, ";") {
+		if strings.IndexByte(seg, '=') > -1 && len(rules) > 0 && rules[len(rules)-1] != "" {
+			rules[len(rules)-1] += ";" + seg
+			continue
+		}
+		rules = append(rules, strings.TrimSpace(seg))
+	}
+
+	ranges := make([]MediaRange, 0, len(rules))
+	for _, rule := range rules {
+		if rule == "" {
+			ranges = append(ranges, MediaRange{})
+			continue
+		}
+
+		m, err := ParseMediaRange(rule)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, m)
+	}
+
+	return ranges, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import "testing"
+
+func TestParseMediaRange(t *testing.T) {
+
+	valid := []string{"*/*", "text/*", "application/*+json", "Application/JSON", "multipart/form-data; boundary=abc"}
+	for _, s := range valid {
+		if _, err := ParseMediaRange(s); err != nil {
+			t.Errorf("%s should be valid: %v", s, err)
+		}
+	}
+
+	invalid := []string{"", "text", "text/", "*/json", "te*t/html", "application/vnd*+json", "application/*+*", "text/html; charset"}
+	for _, s := range invalid {
+		if _, err := ParseMediaRange(s); err == nil {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
+
+func TestContentAllowed(t *testing.T) {
+
+	tests := []struct {
+		rules       string
+		contentType string
+		allowed     bool
+	}{
+		{"application/json", "application/json", true},
+		{"application/json", "Application/JSON; charset=utf-8", true},
+		{"application/json", "application/xml", false},
+		{"application/*", "application/xml", true},
+		{"application/*", "text/xml", false},
+		{"*/*", "image/png", true},
+		{"*/*", "", false},
+		{"application/*+json", "application/vnd.api+json", true},
+		{"application/*+json", "application/json", false},
+		{"application/*+xml", "application/atom+xml", true},
+		{"text/plain;charset=utf-8", "text/plain; charset=UTF-8", true},
+		{"text/plain;charset=utf-8", "text/plain; charset=latin1", false},
+		{"text/plain;charset=utf-8", "text/plain", false},
+		{"text/plain;charset=utf-8;multipart/form-data", "multipart/form-data; boundary=abc", true},
+		{";", "", true},
+		{";application/json", "application/json", true},
+		{"application/json", "", false},
+		{"application/json", "application/*", false},
+		{"application/json", "not a media type", false},
+		{"*", "whatever", true},
+	}
+
+	for _, test := range tests {
+		mr := methodRoute{content: test.rules}
+		if test.rules != "*" {
+			rules, err := parseContentRules(test.rules)
+			if err != nil {
+				t.Fatalf("%s: %v", test.rules, err)
+			}
+			mr.contentRules = rules
+		}
+
+		if allowed := mr.contentAllowed(test.contentType); allowed != test.allowed {
+			t.Errorf("rules %q, Content-Type %q: expected %t, got %t", test.rules, test.contentType, test.allowed, allowed)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+
+	// Custom methods registered for all routers with RegisterMethod
+	customMethods   = map[string]struct{}{}
+	customMethodsMu sync.RWMutex
+)
+
+// ValidMethod reports whether method is a valid HTTP method name, a token as defined by RFC 7230
+func ValidMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) > -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterMethod allows method to be registered as route in all routers, in addition to the
+// default HTTP methods. For example PURGE, REPORT or SEARCH. Method names are case sensitive.
+// WebDAV methods can't be registered, they are allowed by the WebDAV field of a router.
+// RegisterMethod panics if method is invalid, use TryRegisterMethod to handle the error instead.
+func RegisterMethod(method string) {
+	if err := TryRegisterMethod(method); err != nil {
+		panic(err)
+	}
+}
+
+// TryRegisterMethod is like RegisterMethod, but returns a *RouteError if method is invalid
+func TryRegisterMethod(method string) error {
+
+	if !ValidMethod(method) {
+		return routeError("RegisterMethod", "", "", method, ErrInvalidMethod)
+	}
+
+	if knownMethod(method) {
+		return nil
+	}
+
+	customMethodsMu.Lock()
+	customMethods[method] = struct{}{}
+	customMethodsMu.Unlock()
+
+	return nil
+}
+
+// RegisterMethod allows method to be registered as route in the router, in addition to the
+// default HTTP methods and the methods registered for all routers. See RegisterMethod.
+// It panics if method is invalid, use TryRegisterMethod to handle the error instead.
+func (sr *SRouter) RegisterMethod(method string) {
+	if err := sr.TryRegisterMethod(method); err != nil {
+		panic(err)
+	}
+}
+
+// TryRegisterMethod is like RegisterMethod, but returns a *RouteError if method is invalid
+func (sr *SRouter) TryRegisterMethod(method string) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if !ValidMethod(method) {
+		return routeError("RegisterMethod", "", "", method, ErrInvalidMethod)
+	}
+
+	if knownMethod(method) {
+		return nil
+	}
+
+	if sr.customMethods == nil {
+		sr.customMethods = make(map[string]struct{})
+	}
+
+	sr.customMethods[method] = struct{}{}
+	return nil
+}
+
+// StandardMethod reports whether method is a default HTTP method, or a WebDAV method if webDAV
+// is true. These methods can be registered as route without registering them with RegisterMethod.
+func StandardMethod(method string, webDAV bool) bool {
+	if _, ok := allowedMethodsHTTP[method]; ok {
+		return true
+	}
+	_, ok := allowedMethodsHTTPWebDAV[method]
+	return ok && webDAV
+}
+
+// knownMethod reports whether method is a default HTTP method or a WebDAV method
+func knownMethod(method string) bool {
+	_, methodHTTP := allowedMethodsHTTP[method]
+	_, methodWebDAV := allowedMethodsHTTPWebDAV[method]
+	return methodHTTP || methodWebDAV
+}
+
+// methodAllowed reports whether method can be registered as route in the router.
+// This should only be called when the router is already locked.
+func (sr *SRouter) methodAllowed(method string) bool {
+
+	if _, ok := allowedMethodsHTTP[method]; ok {
+		return true
+	}
+
+	if _, ok := allowedMethodsHTTPWebDAV[method]; ok {
+		return sr.WebDAV
+	}
+
+	if _, ok := sr.customMethods[method]; ok {
+		return true
+	}
+
+	customMethodsMu.RLock()
+	_, ok := customMethods[method]
+	customMethodsMu.RUnlock()
+
+	return ok
+}
+
+// allowedMethodNames returns all methods that can be registered as route in the router.
+// This should only be called when the router is already locked.
+func (sr *SRouter) allowedMethodNames() []string {
+
+	methods := make([]string, 0, len(allowedMethodsHTTP))
+	for mtd := range allowedMethodsHTTP {
+		methods = append(methods, mtd)
+	}
+
+	if sr.WebDAV {
+		for mtd := range allowedMethodsHTTPWebDAV {
+			methods = append(methods, mtd)
+		}
+	}
+
+	for mtd := range sr.customMethods {
+		methods = append(methods, mtd)
+	}
+
+	customMethodsMu.RLock()
+	for mtd := range customMethods {
+		if _, ok := sr.customMethods[mtd]; !ok {
+			methods = append(methods, mtd)
+		}
+	}
+	customMethodsMu.RUnlock()
+
+	return methods
+}
@@ -0,0 +1,84 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import "testing"
+
+func TestValidMethod(t *testing.T) {
+
+	for _, mtd := range []string{"GET", "PURGE", "M-SEARCH", "X_CUSTOM", "version-control"} {
+		if !ValidMethod(mtd) {
+			t.Errorf("%s should be a valid method", mtd)
+		}
+	}
+
+	for _, mtd := range []string{"", "GET POST", "GET;", "PUR\"GE", "(PURGE)", "PURGÉ"} {
+		if ValidMethod(mtd) {
+			t.Errorf("%q should be an invalid method", mtd)
+		}
+	}
+}
+
+func TestStandardMethod(t *testing.T) {
+
+	tests := []struct {
+		method string
+		webDAV bool
+		want   bool
+	}{
+		{"GET", false, true},
+		{"PROPFIND", false, false},
+		{"PROPFIND", true, true},
+		{"PURGE", true, false},
+		{"get", false, false},
+	}
+
+	for _, test := range tests {
+		if got := StandardMethod(test.method, test.webDAV); got != test.want {
+			t.Errorf("StandardMethod(%q, %v): expected %v, got %v", test.method, test.webDAV, test.want, got)
+		}
+	}
+}
+
+func TestRegisterMethod(t *testing.T) {
+
+	ro := NewRouter()
+	ro.RegisterMethod("PURGE")
+	ro.RegisterMethod("PROPFIND")
+	RegisterMethod("QUERY")
+
+	if !ro.methodAllowed("PURGE") || !ro.methodAllowed("QUERY") {
+		t.Error("registered methods should be allowed")
+	}
+	if ro.methodAllowed("PROPFIND") {
+		t.Error("WebDAV methods should only be allowed by the WebDAV field")
+	}
+	if NewRouter().methodAllowed("PURGE") {
+		t.Error("methods registered for a router should not be allowed in other routers")
+	}
+
+	ro.AddRoute(DefaultHost, "/cache", false, "PURGE", "", paramHandler("purge"))
+	ro.Mount(DefaultHost, "/sub", paramHandler("sub"))
+
+	if status, body := serveStatus(ro, "localhost", "/cache", "PURGE"); status != 200 || body != "purge" {
+		t.Errorf("expected 200 purge, got %d %q", status, body)
+	}
+	if status, body := serveStatus(ro, "localhost", "/sub/x", "QUERY"); status != 200 || body != "sub" {
+		t.Errorf("expected 200 sub, got %d %q", status, body)
+	}
+	if status, _ := serveStatus(ro, "localhost", "/cache", "SEARCH"); status != 405 {
+		t.Errorf("expected 405 for an unregistered method, got %d", status)
+	}
+}
@@ -39,15 +39,131 @@ func (mhf MiddlewareHandlerFunc) MiddlewareHTTP(handler http.Handler) http.Handl
 	return mhf(handler.ServeHTTP)
 }
 
-// UseMiddleware can be used to add Middleware to path routes
+// UseGlobalMiddleware can be used to add Middleware to all routes of the router.
+// It panics if handler is nil, use TryUseGlobalMiddleware to handle the error instead.
+func (sr *SRouter) UseGlobalMiddleware(handler Middleware) {
+	if err := sr.TryUseGlobalMiddleware(handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryUseGlobalMiddleware is like UseGlobalMiddleware, but returns a *RouteError if handler is nil
+func (sr *SRouter) TryUseGlobalMiddleware(handler Middleware) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return routeError("UseGlobalMiddleware", "", "", "", ErrNilHandler)
+	}
+
+	sr.globalMiddleware = append(sr.globalMiddleware, handler)
+
+	for _, tree := range sr.trees {
+		tree.walk(sr.composeRoute)
+	}
+
+	return nil
+}
+
+// UseHostMiddleware can be used to add Middleware to all routes of a host. The host is matched
+// the same way as in AddRoute, so host middleware of DefaultHost doesn't apply to routes of other hosts.
+// It panics on invalid input, use TryUseHostMiddleware to handle the error instead.
+func (sr *SRouter) UseHostMiddleware(host string, handler Middleware) {
+	if err := sr.TryUseHostMiddleware(host, handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryUseHostMiddleware is like UseHostMiddleware, but returns a *RouteError on invalid input
+func (sr *SRouter) TryUseHostMiddleware(host string, handler Middleware) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	// We don't want empty parameters
+	if host == "" {
+		return routeError("UseHostMiddleware", host, "", "", ErrBlankParameter)
+	}
+
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return routeError("UseHostMiddleware", host, "", "", ErrNilHandler)
+	}
+
+	if sr.hostMiddleware == nil {
+		sr.hostMiddleware = make(map[string][]Middleware)
+	}
+
+	host = hostKey(host)
+	sr.hostMiddleware[host] = append(sr.hostMiddleware[host], handler)
+
+	if tree, ok := sr.trees[host]; ok {
+		tree.walk(sr.composeRoute)
+	}
+
+	return nil
+}
+
+// UseMethodMiddleware can be used to add Middleware to a single method route.
+// The route must be registered with AddRoute first. It panics if the route doesn't exist,
+// use TryUseMethodMiddleware to handle the error instead.
+func (sr *SRouter) UseMethodMiddleware(host, path, method string, handler Middleware) {
+	if err := sr.TryUseMethodMiddleware(host, path, method, handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryUseMethodMiddleware is like UseMethodMiddleware, but returns a *RouteError on invalid input
+func (sr *SRouter) TryUseMethodMiddleware(host, path, method string, handler Middleware) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return routeError("UseMethodMiddleware", host, path, method, ErrNilHandler)
+	}
+
+	pr := sr.findPathRoute(host, path)
+	if pr == nil {
+		return routeError("UseMethodMiddleware", host, path, method, ErrRouteNotFound)
+	}
+
+	mr, ok := pr.subRoutes[method]
+	if !ok {
+		return routeError("UseMethodMiddleware", host, path, method, ErrRouteNotFound)
+	}
+
+	mr.middleware = append(mr.middleware, handler)
+	pr.subRoutes[method] = mr
+
+	sr.composeRoute(pr)
+	return nil
+}
+
+// UseMiddleware can be used to add Middleware to path routes.
+// It panics on invalid input, use TryUseMiddleware to handle the error instead.
 func (sr *SRouter) UseMiddleware(host, path string, handler Middleware) {
+	if err := sr.TryUseMiddleware(host, path, handler); err != nil {
+		panic(err)
+	}
+}
+
+// TryUseMiddleware is like UseMiddleware, but returns a *RouteError on invalid input
+func (sr *SRouter) TryUseMiddleware(host, path string, handler Middleware) error {
 
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
 	// We don't want empty parameters
 	if host == "" || path == "" {
-		panic("router: found illegal blank parameters")
+		return routeError("UseMiddleware", host, path, "", ErrBlankParameter)
+	}
+
+	if path[0] != '/' {
+		return routeError("UseMiddleware", host, path, "", ErrNoLeadingSlash)
 	}
 
 	// If the path is not the root, we don't want paths ending with a "/"
@@ -58,22 +174,76 @@ func (sr *SRouter) UseMiddleware(host, path string, handler Middleware) {
 
 	// Handler cannot be nil. This is rare, but we check anyway.
 	if handler == nil {
-		panic("router: nil handler")
+		return routeError("UseMiddleware", host, path, "", ErrNilHandler)
 	}
 
-	if sr.routes == nil {
-		sr.routes = make(map[string]pathRoute)
+	// Parameters in the path must be well formed
+	if isPattern(path) && !validPattern(path) {
+		return routeError("UseMiddleware", host, path, "", ErrInvalidPath)
 	}
 
-	if _, ok := sr.routes[host+path]; !ok {
-		sr.routes[host+path] = pathRoute{
-			subRoutes:  make(map[string]methodRoute),
-			middleware: []Middleware{},
-		}
+	// Host patterns must be well formed
+	if IsHostPattern(host) && !validHostPattern(host) {
+		return routeError("UseMiddleware", host, path, "", ErrInvalidHost)
+	}
+
+	pathRoute := sr.addPathRoute(host, path)
+	if pathRoute == nil {
+		return routeError("UseMiddleware", host, path, "", ErrPathConflict)
 	}
 
-	pathRoute := sr.routes[host+path]
 	pathRoute.middleware = append(pathRoute.middleware, handler)
-	sr.routes[host+path] = pathRoute
+	sr.composeRoute(pathRoute)
+	return nil
+}
+
+// composeRoute composes the middleware chain of pathRoute pr, and wraps the handler of each
+// methodRoute in it. Middleware is executed in the following order: global middleware, host middleware,
+// path middleware, group middleware and method middleware, each in order of registration. This should
+// only be called when the router is already locked.
+func (sr *SRouter) composeRoute(pr *pathRoute) {
+
+	chain := make([]Middleware, 0, len(sr.globalMiddleware)+len(sr.hostMiddleware[pr.host])+len(pr.middleware))
+	chain = append(chain, sr.globalMiddleware...)
+	chain = append(chain, sr.hostMiddleware[pr.host]...)
+	chain = append(chain, pr.middleware...)
+	pr.chain = chain
+
+	for mtd, mr := range pr.subRoutes {
+		mr.stack, mr.chain = composeMethodRoute(chain, mr, mr.middleware)
+
+		// Variants share the method middleware of the method route
+		variants := make([]methodRoute, len(mr.variants))
+		for i, v := range mr.variants {
+			v.stack, v.chain = composeMethodRoute(chain, v, mr.middleware)
+			variants[i] = v
+		}
+		if len(variants) > 0 {
+			mr.variants = variants
+		}
 
+		pr.subRoutes[mtd] = mr
+	}
+}
+
+// composeMethodRoute returns the middleware stack of methodRoute mr, with path chain chain and
+// method middleware middleware, and the handler of mr wrapped in it.
+func composeMethodRoute(chain []Middleware, mr methodRoute, middleware []Middleware) ([]Middleware, http.Handler) {
+
+	stack := append([]Middleware{}, chain...)
+	stack = append(stack, mr.group.stack()...)
+	stack = append(stack, middleware...)
+
+	if mr.handler == nil {
+		return stack, nil
+	}
+	return stack, wrapMiddleware(mr.handler, stack)
+}
+
+// wrapMiddleware wraps handler in middleware. The first middleware is executed first.
+func wrapMiddleware(handler http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i].MiddlewareHTTP(handler)
+	}
+	return handler
 }
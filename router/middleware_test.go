@@ -61,3 +61,46 @@ func TestMiddleware(t *testing.T) {
 	fmt.Println(string(resp))
 
 }
+
+func namedMiddleware(name string) Middleware {
+	return MiddlewareHandlerFunc(func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s,", name)
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+
+	ro := NewRouter()
+
+	// Middleware registered before and after the route, on every level
+	ro.UseGlobalMiddleware(namedMiddleware("global1"))
+	ro.UseHostMiddleware(DefaultHost, namedMiddleware("host1"))
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "handler")
+	}))
+	ro.UseMethodMiddleware(DefaultHost, "/", "GET", namedMiddleware("method"))
+	ro.UseMiddleware(DefaultHost, "/", namedMiddleware("path"))
+	ro.UseHostMiddleware(DefaultHost, namedMiddleware("host2"))
+	ro.UseHostMiddleware("127.0.0.1", namedMiddleware("otherhost"))
+	ro.UseGlobalMiddleware(namedMiddleware("global2"))
+
+	w := httptest.NewRecorder()
+	ro.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	expected := "global1,global2,host1,host2,path,method,handler"
+	if w.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.Body.String())
+	}
+
+	// Automatic OPTIONS responses pass the middleware of the path route, but not method middleware
+	w = httptest.NewRecorder()
+	ro.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/", nil))
+
+	expected = "global1,global2,host1,host2,path,"
+	if w.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.Body.String())
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mediaTypeKey is the context key under which the negotiated media type is stored
+type mediaTypeKey struct{}
+
+// MediaType returns the media type negotiated for request r, from the media types
+// produced by the route and the Accept header of the request. If the route doesn't
+// declare the media types it produces, an empty string is returned.
+func MediaType(r *http.Request) string {
+	mt, _ := r.Context().Value(mediaTypeKey{}).(string)
+	return mt
+}
+
+// withMediaType returns a shallow copy of r carrying the negotiated media type
+func withMediaType(r *http.Request, mediaType string) *http.Request {
+	if mediaType == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), mediaTypeKey{}, mediaType))
+}
+
+// SetProduces declares the media types a method route produces. This allows multiple entries,
+// separated by semicolon, in order of preference. For example "text/html;application/json".
+// Requests are only dispatched to the route if the Accept header of the request accepts one of
+// the media types, otherwise the router responds with 406. The route must be registered with AddRoute first.
+// The media types apply to the routes with predicates of the method as well.
+//
+// SetProduces panics if the route doesn't exist or a media type is invalid, use TrySetProduces
+// to handle the error instead.
+func (sr *SRouter) SetProduces(host, path, method, produces string) {
+	if err := sr.TrySetProduces(host, path, method, produces); err != nil {
+		panic(err)
+	}
+}
+
+// TrySetProduces is like SetProduces, but returns a *RouteError on invalid input
+func (sr *SRouter) TrySetProduces(host, path, method, produces string) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	pr := sr.findPathRoute(host, path)
+	if pr == nil {
+		return routeError("SetProduces", host, path, method, ErrRouteNotFound)
+	}
+
+	mr, ok := pr.subRoutes[method]
+	if !ok {
+		return routeError("SetProduces", host, path, method, ErrRouteNotFound)
+	}
+
+	var types []string
+	for _, mt := range strings.Split(produces, ";") {
+		if mt = strings.TrimSpace(mt); mt == "" {
+			continue
+		}
+
+		// Produced media types must be well formed, and can't be a wildcard
+		if m, err := ParseMediaRange(mt); err != nil || m.IsWildcard() {
+			return routeError("SetProduces", host, path, method, fmt.Errorf("%w %s", ErrInvalidMediaType, mt))
+		}
+
+		types = append(types, mt)
+	}
+
+	mr.produces = types
+
+	variants := make([]methodRoute, len(mr.variants))
+	for i, v := range mr.variants {
+		v.produces = mr.produces
+		variants[i] = v
+	}
+	if len(variants) > 0 {
+		mr.variants = variants
+	}
+
+	pr.subRoutes[method] = mr
+	return nil
+}
+
+// negotiate returns the media type of produces that is most acceptable according to Accept
+// header accept. Of media types with the same quality, the first one in produces wins. An empty
+// Accept header accepts any media type. An empty string is returned if no media type is acceptable.
+func negotiate(accept string, produces []string) string {
+
+	if strings.TrimSpace(accept) == "" {
+		return produces[0]
+	}
+
+	var best string
+	var bestQ float64
+
+	for _, mt := range produces {
+		if q := acceptQuality(accept, mt); q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the quality Accept header accept assigns to media type mt.
+// The most specific matching media range determines the quality, so text/html;q=0
+// excludes text/html even if text/* or */* is accepted.
+func acceptQuality(accept, mt string) float64 {
+
+	produced, err := ParseMediaRange(mt)
+	if err != nil {
+		return 0
+	}
+
+	quality, specificity := 0.0, -1
+
+	for _, s := range strings.Split(accept, ",") {
+
+		mediaRange, err := ParseMediaRange(s)
+		if err != nil {
+			continue
+		}
+
+		// The quality is a parameter of the Accept header, not of the media range
+		q := 1.0
+		if v, ok := mediaRange.Params["q"]; ok {
+			delete(mediaRange.Params, "q")
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		if !mediaRange.Match(produced) {
+			continue
+		}
+
+		if spec := rangeSpecificity(mediaRange); spec > specificity {
+			specificity, quality = spec, q
+		}
+	}
+
+	return quality
+}
+
+// rangeSpecificity ranks media ranges: a specific type precedes a suffix wildcard,
+// which precedes a subtype wildcard and */*. Parameters make a media range more specific.
+func rangeSpecificity(m MediaRange) int {
+
+	var spec int
+	switch {
+	case m.Type == "*":
+	case m.Subtype == "*":
+		spec = 1
+	case strings.HasPrefix(m.Subtype, "*+"):
+		spec = 2
+	default:
+		spec = 3
+	}
+
+	return spec<<8 + len(m.Params)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+
+	produces := []string{"text/html", "application/json"}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/html"},
+		{"*/*", "text/html"},
+		{"application/json", "application/json"},
+		{"application/*", "application/json"},
+		{"text/html;q=0.5, application/json", "application/json"},
+		{"text/html, application/json", "text/html"},
+		{"TEXT/HTML;Q=0.9, */*;q=0.1", "text/html"},
+		{"*/*, text/html;q=0", "application/json"},
+		{"image/png", ""},
+		{"application/json;q=0", ""},
+		{"application/*+json", ""},
+		{"text/*;q=0.2, application/*;q=0.4", "application/json"},
+		{"text/html;level=1", ""},
+	}
+
+	for _, test := range tests {
+		if got := negotiate(test.accept, produces); got != test.want {
+			t.Errorf("Accept %q: expected %q, got %q", test.accept, test.want, got)
+		}
+	}
+}
+
+func TestProduces(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/resource", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, MediaType(r))
+	}))
+	ro.SetProduces(DefaultHost, "/resource", "GET", "text/html;application/json")
+
+	tests := []struct {
+		accept string
+		status int
+		body   string
+	}{
+		{"", 200, "text/html"},
+		{"application/json, text/html;q=0.8", 200, "application/json"},
+		{"image/*", 406, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/resource", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		ro.ServeHTTP(w, req)
+
+		if w.Code != test.status || test.status == 200 && w.Body.String() != test.body {
+			t.Errorf("Accept %q: expected %d %q, got %d %q", test.accept, test.status, test.body, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: expected Vary: Accept", test.accept)
+		}
+	}
+}
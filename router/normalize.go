@@ -0,0 +1,231 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NormalizeAction determines how the router handles a request for a path that
+// isn't in its canonical form
+type NormalizeAction int
+
+const (
+	// NormalizeServe serves the request in place. Handlers receive the canonical path.
+	NormalizeServe NormalizeAction = iota
+
+	// NormalizeRedirect redirects the client to the canonical path
+	NormalizeRedirect
+
+	// NormalizeReject responds with a 404 error
+	NormalizeReject
+)
+
+// TrailingSlash determines the canonical form of a path regarding a trailing slash
+type TrailingSlash int
+
+const (
+	// TrailingSlashKeep keeps a trailing slash as requested. Both /docs and /docs/ are canonical.
+	TrailingSlashKeep TrailingSlash = iota
+
+	// TrailingSlashStrip makes paths without trailing slash canonical
+	TrailingSlashStrip
+
+	// TrailingSlashAdd makes paths with a trailing slash canonical
+	TrailingSlashAdd
+)
+
+// NormalizePolicy configures how the router normalizes request paths. The canonical form of
+// a request path has no dot segments or duplicate slashes, uses the minimal percent-encoding,
+// and has a trailing slash according to TrailingSlash. The zero value serves every request in
+// place and keeps trailing slashes, which is the default of the router.
+type NormalizePolicy struct {
+
+	// Action determines how a request for a path that isn't canonical is handled
+	Action NormalizeAction
+
+	// RedirectCode is the status code of redirects, 301 or 308. Defaults to 301.
+	// Use 308 to make clients repeat the request method and body.
+	RedirectCode int
+
+	// TrailingSlash determines whether the canonical form of a path has a trailing slash
+	TrailingSlash TrailingSlash
+
+	// CaseInsensitive matches the static parts of route paths case insensitive, for ASCII
+	// letters. The canonical form of a path uses the case of the matched route.
+	CaseInsensitive bool
+}
+
+// SetNormalizePolicy sets the normalization policy of host. The host is matched the same way
+// as in AddRoute: the policy applies to requests matching a route of host. Requests matching
+// a route of a host without policy use the policy of the Normalize field of the router.
+//
+// SetNormalizePolicy panics on invalid input, use TrySetNormalizePolicy to handle the error instead.
+func (sr *SRouter) SetNormalizePolicy(host string, policy NormalizePolicy) {
+	if err := sr.TrySetNormalizePolicy(host, policy); err != nil {
+		panic(err)
+	}
+}
+
+// TrySetNormalizePolicy is like SetNormalizePolicy, but returns a *RouteError on invalid input
+func (sr *SRouter) TrySetNormalizePolicy(host string, policy NormalizePolicy) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	// We don't want empty parameters
+	if host == "" {
+		return routeError("SetNormalizePolicy", host, "", "", ErrBlankParameter)
+	}
+
+	if policy.RedirectCode != 0 && policy.RedirectCode != http.StatusMovedPermanently && policy.RedirectCode != http.StatusPermanentRedirect {
+		return routeError("SetNormalizePolicy", host, "", "", ErrRedirectCode)
+	}
+
+	if sr.hostNormalize == nil {
+		sr.hostNormalize = make(map[string]NormalizePolicy)
+	}
+
+	sr.hostNormalize[hostKey(host)] = policy
+	return nil
+}
+
+// normalizePolicy returns the normalization policy of host.
+// This should only be called when the router is already locked.
+func (sr *SRouter) normalizePolicy(host string) NormalizePolicy {
+	if policy, ok := sr.hostNormalize[host]; ok {
+		return policy
+	}
+	return sr.Normalize
+}
+
+// normalize applies the normalization policy of the matched route to request r, of which
+// the path was requested as escaped. It returns false if the request has been answered with
+// a redirect or error, otherwise the request path is set to the canonical path.
+func (sr *SRouter) normalize(w http.ResponseWriter, r *http.Request, match routeMatch, requested string) bool {
+
+	sr.mu.RLock()
+	canonical, status := sr.normalization(match, r.URL.Path, requested)
+	sr.mu.RUnlock()
+
+	switch status {
+	case 200:
+		r.URL.Path = canonical
+		r.URL.RawPath = ""
+		return true
+
+	case 404:
+		sr.ErrorHandler(w, r, 404)
+		return false
+	}
+
+	escaped := (&url.URL{Path: canonical}).EscapedPath()
+	if r.URL.RawQuery != "" {
+		escaped += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", escaped)
+	w.WriteHeader(status)
+	return false
+}
+
+// normalization returns the canonical path of clean request path p, which matched route match and
+// was requested as escaped, and the status of the response to the request. The status is 200 if the
+// request is served, a redirect code if the client is redirected to the canonical path, or 404 if
+// the request is rejected. This should only be called when the router is already locked.
+func (sr *SRouter) normalization(match routeMatch, p, requested string) (string, int) {
+
+	policy := sr.normalizePolicy(match.pathRoute.host)
+	canonical := canonicalPath(policy, match, p)
+
+	if (&url.URL{Path: canonical}).EscapedPath() == requested {
+		return canonical, 200
+	}
+
+	switch policy.Action {
+	case NormalizeRedirect:
+		if policy.RedirectCode == 0 {
+			return canonical, http.StatusMovedPermanently
+		}
+		return canonical, policy.RedirectCode
+
+	case NormalizeReject:
+		return canonical, 404
+	}
+
+	return canonical, 200
+}
+
+// canonicalPath returns the canonical form of clean request path p, which matched route match.
+func canonicalPath(policy NormalizePolicy, match routeMatch, p string) string {
+
+	// Static parts of the path take the case of the route. Static parts and captured
+	// parameters have the same length in route and path, so the part of the path
+	// that wasn't matched by the route can be appended as is.
+	if policy.CaseInsensitive {
+		if expanded := expandPattern(match.pathRoute.path, match.params); len(expanded) <= len(p) {
+			p = expanded + p[len(expanded):]
+		}
+	}
+
+	switch {
+	case p == "/":
+	case policy.TrailingSlash == TrailingSlashStrip:
+		p = strings.TrimSuffix(p, "/")
+	case policy.TrailingSlash == TrailingSlashAdd && !strings.HasSuffix(p, "/"):
+		p += "/"
+	}
+
+	return p
+}
+
+// expandPattern replaces the parameters of route path pattern by their values. Path parameters
+// are the last parameters of params, they can be preceded by labels captured by a host pattern.
+func expandPattern(pattern string, params RouteParams) string {
+
+	if !isPattern(pattern) {
+		return pattern
+	}
+
+	segments := strings.Split(pattern[1:], "/")
+
+	var n int
+	for _, seg := range segments {
+		if segmentKind(seg) != segmentStatic {
+			n++
+		}
+	}
+	if n > len(params) {
+		return pattern
+	}
+	params = params[len(params)-n:]
+
+	var b strings.Builder
+	for _, seg := range segments {
+		if segmentKind(seg) == segmentStatic {
+			b.WriteString("/" + seg)
+			continue
+		}
+
+		// A catch-all parameter can match an empty remainder, without slash
+		if params[0].Value != "" || segmentKind(seg) == segmentParam {
+			b.WriteString("/" + params[0].Value)
+		}
+		params = params[1:]
+	}
+
+	return b.String()
+}
@@ -0,0 +1,92 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", paramHandler("root"))
+	ro.AddRoute(DefaultHost, "/Docs", true, "GET", "", paramHandler("docs"))
+	ro.AddRoute(DefaultHost, "/users/:name", false, "GET", "", paramHandler("user"))
+	ro.AddRoute("strict.example.com", "/docs", false, "GET", "", paramHandler("strict"))
+	ro.AddRoute("serve.example.com", "/docs", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	ro.Normalize = NormalizePolicy{
+		Action:          NormalizeRedirect,
+		TrailingSlash:   TrailingSlashStrip,
+		CaseInsensitive: true,
+	}
+	ro.SetNormalizePolicy("strict.example.com", NormalizePolicy{Action: NormalizeReject})
+	ro.SetNormalizePolicy("serve.example.com", NormalizePolicy{TrailingSlash: TrailingSlashAdd})
+
+	tests := []struct {
+		host     string
+		target   string
+		status   int
+		location string
+		body     string
+	}{
+		{"localhost", "/Docs", 200, "", "docs"},
+		{"localhost", "/Docs/", 301, "/Docs", ""},
+		{"localhost", "/docs", 301, "/Docs", ""},
+		{"localhost", "/DOCS/intro?page=2", 301, "/Docs/intro?page=2", ""},
+		{"localhost", "/a/../Docs", 301, "/Docs", ""},
+		{"localhost", "//Docs", 301, "/Docs", ""},
+		{"localhost", "/%44ocs", 301, "/Docs", ""},
+		{"localhost", "/USERS/Bob", 301, "/users/Bob", ""},
+		{"localhost", "/users/Bob", 200, "", "user name=Bob"},
+		{"localhost", "/", 200, "", "root"},
+		{"strict.example.com", "/docs", 200, "", "strict"},
+		{"strict.example.com", "/./docs", 404, "", ""},
+		{"serve.example.com", "/docs", 200, "", "/docs/"},
+		{"serve.example.com", "/x/../docs/", 200, "", "/docs/"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.target, nil)
+		req.Host = test.host
+		ro.ServeHTTP(w, req)
+
+		switch {
+		case w.Code != test.status:
+			t.Errorf("%s%s: expected %d, got %d", test.host, test.target, test.status, w.Code)
+		case w.Header().Get("Location") != test.location:
+			t.Errorf("%s%s: expected Location %q, got %q", test.host, test.target, test.location, w.Header().Get("Location"))
+		case test.status == 200 && w.Body.String() != test.body:
+			t.Errorf("%s%s: expected %q, got %q", test.host, test.target, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestExpandPattern(t *testing.T) {
+
+	params := RouteParams{{"tenant", "acme"}, {"id", "42"}, {"rest", ""}}
+
+	if p := expandPattern("/users/:id/files/*rest", params); p != "/users/42/files" {
+		t.Errorf("expected /users/42/files, got %s", p)
+	}
+	if p := expandPattern("/docs", nil); p != "/docs" {
+		t.Errorf("expected /docs, got %s", p)
+	}
+}
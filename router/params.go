@@ -0,0 +1,112 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// RouteParam is a single value captured from a request by a route pattern.
+type RouteParam struct {
+	Key   string
+	Value string
+}
+
+// RouteParams holds all values captured from a request by a route pattern,
+// in the order they appear in the pattern.
+type RouteParams []RouteParam
+
+// Get returns the value of the parameter with the given name.
+// If the parameter doesn't exist an empty string is returned.
+func (rp RouteParams) Get(name string) string {
+	for _, p := range rp {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// paramsKey is the context key under which RouteParams are stored
+type paramsKey struct{}
+
+// Param returns the value of the named route parameter captured for request r.
+// Named parameters are defined with a colon, for example /users/:id, catch-all
+// parameters with an asterisk, for example /files/*rest.
+// If the parameter doesn't exist an empty string is returned.
+func Param(r *http.Request, name string) string {
+	return ParamsFromRequest(r).Get(name)
+}
+
+// ParamsFromRequest returns all route parameters captured for request r
+func ParamsFromRequest(r *http.Request) RouteParams {
+	if rp, ok := r.Context().Value(paramsKey{}).(RouteParams); ok {
+		return rp
+	}
+	return nil
+}
+
+// withParams returns a shallow copy of r carrying the route parameters. Parameters
+// captured by a router that mounted the current router precede the parameters.
+func withParams(r *http.Request, rp RouteParams) *http.Request {
+	if len(rp) == 0 {
+		return r
+	}
+	if outer := ParamsFromRequest(r); len(outer) > 0 {
+		rp = append(outer[:len(outer):len(outer)], rp...)
+	}
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, rp))
+}
+
+// Segment kinds of a route pattern
+const (
+	segmentStatic = iota
+	segmentParam
+	segmentCatchAll
+)
+
+// isPattern reports whether path contains named or catch-all parameters
+func isPattern(path string) bool {
+	return strings.Contains(path, "/:") || strings.Contains(path, "/*")
+}
+
+// segmentKind returns the kind of a single pattern segment
+func segmentKind(seg string) int {
+	switch {
+	case strings.HasPrefix(seg, ":"):
+		return segmentParam
+	case strings.HasPrefix(seg, "*"):
+		return segmentCatchAll
+	}
+	return segmentStatic
+}
+
+// validPattern reports whether a pattern path is well formed. Segments can't be empty,
+// parameters need a name and a catch-all parameter may only be used as the last segment.
+func validPattern(path string) bool {
+	segments := strings.Split(path[1:], "/")
+	for i, seg := range segments {
+		kind := segmentKind(seg)
+		if seg == "" || kind != segmentStatic && len(seg) < 2 {
+			return false
+		}
+		if kind == segmentCatchAll && i != len(segments)-1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func paramHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", name)
+		for _, p := range ParamsFromRequest(r) {
+			fmt.Fprintf(w, " %s=%s", p.Key, p.Value)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/users/:id", false, "GET", "", paramHandler("user"))
+	ro.AddRoute(DefaultHost, "/users/me", false, "GET", "", paramHandler("me"))
+	ro.AddRoute(DefaultHost, "/users/:id/files/*rest", false, "GET", "", paramHandler("files"))
+	ro.AddRoute(DefaultHost, "/users/:id/:action", false, "GET", "", paramHandler("action"))
+	ro.AddRoute(DefaultHost, "/static/*path", false, "GET", "", paramHandler("static"))
+	ro.AddRoute(DefaultHost, "/posts/:id", true, "GET", "", paramHandler("post"))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/users/42", 200, "user id=42"},
+		{"/users/me", 200, "me"},
+		{"/users/42/files/a/b.txt", 200, "files id=42 rest=a/b.txt"},
+		{"/users/42/files", 200, "files id=42 rest="},
+		{"/users/42/edit", 200, "action id=42 action=edit"},
+		{"/users/42/edit/more", 404, ""},
+		{"/users", 404, ""},
+		{"/static/", 200, "static path="},
+		{"/static/css/main.css", 200, "static path=css/main.css"},
+		{"/posts/7/comments", 200, "post id=7"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %s", err)
+		}
+		ro.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, w.Code)
+			continue
+		}
+		if test.status == 200 && w.Body.String() != test.body {
+			t.Errorf("%s: expected %q, got %q", test.path, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestParam(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/users/:id", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := Param(r, "id"); id != "42" {
+			t.Errorf("expected id 42, got %q", id)
+		}
+		if missing := Param(r, "missing"); missing != "" {
+			t.Errorf("expected empty value, got %q", missing)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/users/42", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %s", err)
+	}
+	ro.ServeHTTP(w, req)
+}
+
+func TestValidPattern(t *testing.T) {
+	valid := []string{"/users/:id", "/files/*rest", "/a/:b/c/*d"}
+	invalid := []string{"/users/:", "/files/*", "/files/*rest/more", "/a//:b"}
+
+	for _, p := range valid {
+		if !validPattern(p) {
+			t.Errorf("%s should be valid", p)
+		}
+	}
+	for _, p := range invalid {
+		if validPattern(p) {
+			t.Errorf("%s should be invalid", p)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// PredicateKind is the part of a request a Predicate tests
+type PredicateKind int
+
+// Kinds of predicates
+const (
+	PredicateHeader PredicateKind = iota
+	PredicateQuery
+	PredicateCookie
+)
+
+// predicateKinds holds the names of the predicate kinds, as used by ParsePredicate
+var predicateKinds = map[string]PredicateKind{
+	"header": PredicateHeader,
+	"query":  PredicateQuery,
+	"cookie": PredicateCookie,
+}
+
+// Predicate is a condition on a header, query parameter or cookie of a request. If Value is
+// empty, the header, query parameter or cookie only has to be present. Routes with predicates
+// are registered with AddRouteWhen.
+type Predicate struct {
+	Kind  PredicateKind
+	Name  string
+	Value string
+}
+
+// ParsePredicate parses a predicate in the form kind:name or kind:name=value, where kind
+// is header, query or cookie. For example "header:X-API-Version=2" or "query:debug".
+func ParsePredicate(s string) (Predicate, error) {
+
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return Predicate{}, errors.New("router: predicate " + s + " has no kind")
+	}
+
+	kind, ok := predicateKinds[strings.ToLower(strings.TrimSpace(s[:i]))]
+	if !ok {
+		return Predicate{}, errors.New("router: predicate " + s + " has an unknown kind")
+	}
+
+	p := Predicate{Kind: kind, Name: strings.TrimSpace(s[i+1:])}
+	if j := strings.IndexByte(p.Name, '='); j > -1 {
+		p.Name, p.Value = strings.TrimSpace(p.Name[:j]), strings.TrimSpace(p.Name[j+1:])
+	}
+
+	if p.Name == "" {
+		return Predicate{}, errors.New("router: predicate " + s + " has no name")
+	}
+
+	return p, nil
+}
+
+// ParsePredicates parses multiple predicates separated by semicolon, see ParsePredicate
+func ParsePredicates(s string) ([]Predicate, error) {
+
+	var predicates []Predicate
+	for _, v := range strings.Split(s, ";") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		p, err := ParsePredicate(v)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+
+	return predicates, nil
+}
+
+// String returns the predicate in the form accepted by ParsePredicate
+func (p Predicate) String() string {
+
+	var kind string
+	for k, v := range predicateKinds {
+		if v == p.Kind {
+			kind = k
+		}
+	}
+
+	if p.Value == "" {
+		return kind + ":" + p.Name
+	}
+	return kind + ":" + p.Name + "=" + p.Value
+}
+
+// Match reports whether request r satisfies the predicate
+func (p Predicate) Match(r *http.Request) bool {
+
+	if r == nil {
+		return false
+	}
+
+	switch p.Kind {
+	case PredicateHeader:
+		values, ok := r.Header[http.CanonicalHeaderKey(p.Name)]
+		return ok && (p.Value == "" || containsValue(values, p.Value))
+
+	case PredicateQuery:
+		values, ok := r.URL.Query()[p.Name]
+		return ok && (p.Value == "" || containsValue(values, p.Value))
+
+	case PredicateCookie:
+		c, err := r.Cookie(p.Name)
+		return err == nil && (p.Value == "" || c.Value == p.Value)
+	}
+
+	return false
+}
+
+// containsValue reports whether values contains value
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRouteWhen adds a route that is only dispatched to if the request satisfies all predicates.
+// Several routes can be registered for the same host, path and method, as long as their predicates
+// differ. Routes with predicates are tried in order of registration, before the route without
+// predicates registered with AddRoute. If no route matches the request, the router responds with 404.
+// All other parameters are the same as AddRoute.
+//
+// AddRouteWhen calls log.Fatal if the route is invalid, use TryAddRouteWhen to handle the error instead.
+func (sr *SRouter) AddRouteWhen(host, path string, fallback bool, method, content string, handler http.Handler, predicates ...Predicate) {
+	if err := sr.TryAddRouteWhen(host, path, fallback, method, content, handler, predicates...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryAddRouteWhen is like AddRouteWhen, but returns a *RouteError if the route is invalid
+func (sr *SRouter) TryAddRouteWhen(host, path string, fallback bool, method, content string, handler http.Handler, predicates ...Predicate) error {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	return routeError("AddRouteWhen", host, path, method, sr.addRoute(host, path, fallback, method, content, handler, nil, predicates...))
+}
+
+// matchRequest returns the route of method route mr matching request r. Routes with predicates
+// are tried first, in order of registration. It returns false if no route matches r.
+func (mr methodRoute) matchRequest(r *http.Request) (methodRoute, bool) {
+
+	for _, v := range mr.variants {
+		if v.matchPredicates(r) {
+			return v, true
+		}
+	}
+
+	return mr, mr.handler != nil
+}
+
+// matchPredicates reports whether request r satisfies all predicates of method route mr
+func (mr methodRoute) matchPredicates(r *http.Request) bool {
+	for _, p := range mr.predicates {
+		if !p.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// samePredicates reports whether a and b hold the same predicates, in any order
+func samePredicates(a, b []Predicate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, p := range a {
+		var found bool
+		for _, q := range b {
+			if p == q {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePredicate(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want Predicate
+	}{
+		{"header:X-API-Version=2", Predicate{PredicateHeader, "X-API-Version", "2"}},
+		{"query:debug", Predicate{PredicateQuery, "debug", ""}},
+		{"Cookie: beta = 1", Predicate{PredicateCookie, "beta", "1"}},
+	}
+
+	for _, test := range tests {
+		p, err := ParsePredicate(test.s)
+		if err != nil || p != test.want {
+			t.Errorf("%s: expected %+v, got %+v %v", test.s, test.want, p, err)
+		}
+		if q, _ := ParsePredicate(p.String()); q != p {
+			t.Errorf("%s: String doesn't round trip: %s", test.s, p.String())
+		}
+	}
+
+	for _, s := range []string{"", "X-API-Version=2", "body:x", "header:", "query:=1"} {
+		if _, err := ParsePredicate(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRouteWhen(DefaultHost, "/api", false, "GET", "", paramHandler("v2"), Predicate{PredicateHeader, "X-API-Version", "2"})
+	ro.AddRoute(DefaultHost, "/api", false, "GET", "", paramHandler("v1"))
+	ro.AddRouteWhen(DefaultHost, "/api", false, "GET", "", paramHandler("beta"), Predicate{PredicateQuery, "beta", ""}, Predicate{PredicateCookie, "tester", "yes"})
+	ro.AddRouteWhen(DefaultHost, "/preview", false, "GET", "", paramHandler("preview"), Predicate{Kind: PredicateCookie, Name: "preview"})
+	ro.UseMethodMiddleware(DefaultHost, "/api", "GET", namedMiddleware("method"))
+
+	tests := []struct {
+		target string
+		header string
+		cookie string
+		status int
+		body   string
+	}{
+		{"/api", "", "", 200, "method,v1"},
+		{"/api", "2", "", 200, "method,v2"},
+		{"/api", "3", "", 200, "method,v1"},
+		{"/api?beta", "", "tester=yes", 200, "method,beta"},
+		{"/api?beta", "2", "tester=yes", 200, "method,v2"},
+		{"/api?beta", "", "tester=no", 200, "method,v1"},
+		{"/preview", "", "preview=1", 200, "preview"},
+		{"/preview", "", "", 404, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.target, nil)
+		if test.header != "" {
+			req.Header.Set("X-API-Version", test.header)
+		}
+		if test.cookie != "" {
+			req.Header.Set("Cookie", test.cookie)
+		}
+		ro.ServeHTTP(w, req)
+
+		if w.Code != test.status || test.status == 200 && w.Body.String() != test.body {
+			t.Errorf("%s %q %q: expected %d %q, got %d %q", test.target, test.header, test.cookie, test.status, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	var routes []Route
+	ro.Routes(func(rt Route) bool {
+		routes = append(routes, rt)
+		return true
+	})
+	if len(routes) != 4 || len(routes[0].Predicates) != 1 || len(routes[2].Predicates) != 0 {
+		t.Errorf("expected the routes with predicates before the route without, got %+v", routes)
+	}
+
+	if e := ro.Explain("localhost", "/api?beta", "GET", "", ""); e.Route == nil || len(e.Route.Predicates) != 0 {
+		t.Errorf("expected the route without predicates, got %+v", e.Route)
+	}
+
+	if !ro.RemoveRoute(DefaultHost, "/api", "GET") {
+		t.Fatal("removing GET /api failed")
+	}
+	if status, _ := serveStatus(ro, "localhost", "/api", "GET"); status != 404 {
+		t.Errorf("expected 404 after removing /api, got %d", status)
+	}
+}
+
+func TestPredicateNilRequest(t *testing.T) {
+	if (Predicate{Kind: PredicateHeader, Name: "X"}).Match(nil) {
+		t.Error("a predicate should not match a nil request")
+	}
+	if !(Predicate{Kind: PredicateHeader, Name: "X"}).Match(&http.Request{Header: http.Header{"X": {""}}}) {
+		t.Error("a predicate without value should match a present header")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+// RemoveRoute removes the route for the host, path and method combination from the router.
+// The host and path must be written exactly as they were passed to AddRoute. Routes of the method with
+// predicates are removed as well. It returns false if the route doesn't exist. Requests that are already
+// being handled by the route finish normally.
+func (sr *SRouter) RemoveRoute(host, path, method string) bool {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	pr := sr.findPathRoute(host, path)
+	if pr == nil {
+		return false
+	}
+
+	if _, ok := pr.subRoutes[method]; !ok {
+		return false
+	}
+
+	delete(pr.subRoutes, method)
+	sr.removeUnusedPathRoute(host, pr)
+
+	return true
+}
+
+// RemoveMiddleware removes all middleware from the path route of the host and path combination.
+// The host and path must be written exactly as they were passed to UseMiddleware. Middleware can't
+// be compared, so to change the middleware of a path route the complete chain should be removed and
+// registered again. It returns false if the path route doesn't exist or doesn't have middleware.
+func (sr *SRouter) RemoveMiddleware(host, path string) bool {
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	pr := sr.findPathRoute(host, path)
+	if pr == nil || len(pr.middleware) == 0 {
+		return false
+	}
+
+	pr.middleware = []Middleware{}
+	sr.composeRoute(pr)
+	sr.removeUnusedPathRoute(host, pr)
+
+	return true
+}
+
+// ReplaceRoutes atomically replaces all routes and middleware of the router with those of src,
+// including global and host middleware, the normalization policies of hosts and custom methods.
+// The WebDAV, AutoMethods and Normalize settings of src are copied as well, so they change together
+// with the routes.
+// This allows building a complete new route table off to the side, with a router returned by NewRouter,
+// and swapping it in while the router is serving requests. Requests in flight finish on the old routes.
+// After ReplaceRoutes src is empty and can be reused to build another route table.
+func (sr *SRouter) ReplaceRoutes(src *SRouter) {
+
+	src.mu.Lock()
+	trees, hostPatterns := src.trees, src.hostPatterns
+	globalMiddleware, hostMiddleware := src.globalMiddleware, src.hostMiddleware
+	src.trees, src.hostPatterns = nil, nil
+	src.globalMiddleware, src.hostMiddleware = nil, nil
+	hostNormalize, customMethods := src.hostNormalize, src.customMethods
+	src.hostNormalize, src.customMethods = nil, nil
+	webDAV, autoMethods, normalize := src.WebDAV, src.AutoMethods, src.Normalize
+	src.mu.Unlock()
+
+	sr.mu.Lock()
+	sr.trees, sr.hostPatterns = trees, hostPatterns
+	sr.globalMiddleware, sr.hostMiddleware = globalMiddleware, hostMiddleware
+	sr.hostNormalize, sr.customMethods = hostNormalize, customMethods
+	sr.WebDAV, sr.AutoMethods, sr.Normalize = webDAV, autoMethods, normalize
+	sr.mu.Unlock()
+}
+
+// findPathRoute returns the pathRoute registered for the host and path combination, or nil if it
+// doesn't exist. This should only be called when the router is already locked.
+func (sr *SRouter) findPathRoute(host, path string) *pathRoute {
+
+	// Paths are registered without trailing slash, except for the root
+	if path != "/" && path != "" && path[len(path)-1] == '/' {
+		path = path[:len(path)-1]
+	}
+
+	tree, ok := sr.trees[hostKey(host)]
+	if !ok || path == "" {
+		return nil
+	}
+
+	n := tree.find(path)
+	if n == nil {
+		return nil
+	}
+
+	return n.route
+}
+
+// removeUnusedPathRoute removes a pathRoute without methods and middleware from the tree of the host.
+// Trees without routes are removed entirely. This should only be called when the router is already locked.
+func (sr *SRouter) removeUnusedPathRoute(host string, pr *pathRoute) {
+
+	if len(pr.subRoutes) > 0 || len(pr.middleware) > 0 {
+		return
+	}
+
+	host = hostKey(host)
+	tree := sr.trees[host]
+	tree.find(pr.path).route = nil
+	tree.prune()
+
+	if !tree.isEmpty() {
+		return
+	}
+
+	delete(sr.trees, host)
+
+	for i, pattern := range sr.hostPatterns {
+		if pattern == host {
+			sr.hostPatterns = append(sr.hostPatterns[:i], sr.hostPatterns[i+1:]...)
+			break
+		}
+	}
+}
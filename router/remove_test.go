@@ -0,0 +1,142 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveStatus(ro *SRouter, host, path, method string) (int, string) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Host = host
+	ro.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestRemoveRoute(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", paramHandler("root"))
+	ro.AddRoute(DefaultHost, "/users/:id", false, "GET", "", paramHandler("user"))
+	ro.AddRoute(DefaultHost, "/users/:id", false, "DELETE", "", paramHandler("delete"))
+	ro.AddRoute("*.example.com", "/", false, "GET", "", paramHandler("wildcard"))
+
+	if ro.RemoveRoute(DefaultHost, "/users/:id", "POST") {
+		t.Error("removing an unregistered method should fail")
+	}
+	if ro.RemoveRoute(DefaultHost, "/users/:name", "GET") {
+		t.Error("removing an unregistered path should fail")
+	}
+
+	if !ro.RemoveRoute(DefaultHost, "/users/:id", "DELETE") {
+		t.Fatal("removing DELETE /users/:id failed")
+	}
+	if status, _ := serveStatus(ro, "localhost", "/users/42", "DELETE"); status != 405 {
+		t.Errorf("expected 405 after removing DELETE, got %d", status)
+	}
+	if status, _ := serveStatus(ro, "localhost", "/users/42", "GET"); status != 200 {
+		t.Errorf("expected 200 for GET, got %d", status)
+	}
+
+	if !ro.RemoveRoute(DefaultHost, "/users/:id/", "GET") {
+		t.Fatal("removing GET /users/:id failed")
+	}
+	if status, _ := serveStatus(ro, "localhost", "/users/42", "GET"); status != 404 {
+		t.Errorf("expected 404 after removing /users/:id, got %d", status)
+	}
+	if tree := ro.trees[DefaultHost]; tree.param != nil || len(tree.children) != 0 {
+		t.Error("unused nodes should be pruned from the tree")
+	}
+
+	if !ro.RemoveRoute("*.example.com", "/", "GET") {
+		t.Fatal("removing the wildcard route failed")
+	}
+	if len(ro.hostPatterns) != 0 {
+		t.Error("the host pattern should be removed with its last route")
+	}
+	if _, body := serveStatus(ro, "www.example.com", "/", "GET"); body != "root" {
+		t.Errorf("expected the default route, got %q", body)
+	}
+}
+
+func TestRemoveMiddleware(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", exampleHandler())
+	ro.UseMiddleware(DefaultHost, "/", MiddlewareHandlerFunc(exampleMiddleware))
+
+	if !ro.RemoveMiddleware(DefaultHost, "/") {
+		t.Fatal("removing middleware failed")
+	}
+	if ro.RemoveMiddleware(DefaultHost, "/") {
+		t.Error("removing middleware twice should fail")
+	}
+	if _, body := serveStatus(ro, "localhost", "/", "GET"); body != "This is an example function\n" {
+		t.Errorf("middleware should no longer be executed, got %q", body)
+	}
+}
+
+func TestReplaceRoutes(t *testing.T) {
+
+	ro := NewRouter()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan string)
+
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("old"))
+	}))
+
+	// Start a request on the old route table, and keep it in flight
+	go func() {
+		_, body := serveStatus(ro, "localhost", "/", "GET")
+		done <- body
+	}()
+	<-started
+
+	table := NewRouter()
+	table.AddRoute(DefaultHost, "/", false, "GET", "", paramHandler("new"))
+	table.AddRoute(DefaultHost, "/added", false, "GET", "", paramHandler("added"))
+	table.WebDAV = true
+	table.AutoMethods = false
+	table.Normalize = NormalizePolicy{TrailingSlash: TrailingSlashStrip}
+	ro.ReplaceRoutes(table)
+
+	if !ro.WebDAV || ro.AutoMethods || ro.Normalize.TrailingSlash != TrailingSlashStrip {
+		t.Error("the settings of the source router should be copied by ReplaceRoutes")
+	}
+
+	if _, body := serveStatus(ro, "localhost", "/added", "GET"); body != "added" {
+		t.Errorf("expected the new route table, got %q", body)
+	}
+	if _, body := serveStatus(ro, "localhost", "/", "GET"); body != "new" {
+		t.Errorf("expected the new route table, got %q", body)
+	}
+
+	close(release)
+	if body := <-done; body != "old" {
+		t.Errorf("the request in flight should finish on the old route table, got %q", body)
+	}
+
+	if status, _ := serveStatus(table, "localhost", "/", "GET"); status != 404 {
+		t.Errorf("the source router should be empty after ReplaceRoutes, got %d", status)
+	}
+}
@@ -16,26 +16,52 @@ package router
 
 import (
 	"net/http"
-	"path"
+	"sort"
 	"strings"
 )
 
 type pathRoute struct {
+	host       string
+	path       string
 	subRoutes  map[string]methodRoute
 	middleware []Middleware
+	chain      []Middleware
 }
 
 type methodRoute struct {
 	handler      http.Handler
+	chain        http.Handler
+	stack        []Middleware
+	middleware   []Middleware
+	group        *RouteGroup
 	host         string
 	path         string
 	pathFallback bool
 	method       string
 	content      string
+	contentRules []MediaRange
+	produces     []string
+	predicates   []Predicate
+	variants     []methodRoute
 }
 
-// Function to retrieve a methodRoute for a HTTP request
-func (sr *SRouter) getRoute(host, path, method, contentType string) (methodRoute, []Middleware, int) {
+// routeMatch is the result of matching a HTTP request to the routes of the router
+type routeMatch struct {
+	pathRoute   pathRoute
+	methodRoute methodRoute
+	params      RouteParams
+	mediaType   string
+	exact       bool
+	status      int
+
+	// allow holds the methods allowed for the path route if the status is 405. It is built
+	// while the router is locked, because the methods of the path route can change afterwards.
+	allow string
+}
+
+// Function to retrieve a methodRoute for a HTTP request. The methodRoute should only be
+// dispatched to if the returned status is 200.
+func (sr *SRouter) getRoute(r *http.Request, host, path, method, contentType, accept string) routeMatch {
 
 	// For concurrency safety, lock mutex
 	sr.mu.RLock()
@@ -44,10 +70,11 @@ func (sr *SRouter) getRoute(host, path, method, contentType string) (methodRoute
 	// Define an empty pathRoute.
 	var pathRouteMatch pathRoute
 	var exactMatch bool
+	var params RouteParams
 
-	// Match a route for host and DefaultHost
-	hostFound, hostExact, hostMatch := sr.matchRoute(host, path)
-	defaultFound, defaultExact, defaultMatch := sr.matchRoute(DefaultHost, path)
+	// Match a route for host, or a host pattern matching host, and DefaultHost
+	hostFound, hostExact, hostMatch, hostParams := sr.matchHost(host, path)
+	defaultFound, defaultExact, defaultMatch, defaultParams := sr.matchRoute(DefaultHost, path)
 
 	// We check which route we use, by checking several cases.
 	// To increase readability of the code all cases have been separated.
@@ -58,58 +85,92 @@ func (sr *SRouter) getRoute(host, path, method, contentType string) (methodRoute
 	case hostFound && !defaultFound:
 		pathRouteMatch = hostMatch
 		exactMatch = hostExact
+		params = hostParams
 
 	// case 2: We found a route for DefaultHost,  but not for Host
 	// Selected route: DefaultHost
 	case defaultFound && !hostFound:
 		pathRouteMatch = defaultMatch
 		exactMatch = defaultExact
+		params = defaultParams
 
 	// case 3: We found a route for both hosts, but host route was an exact match
 	// Selected route: Host
 	case defaultFound && !defaultExact && hostFound && hostExact:
 		pathRouteMatch = hostMatch
 		exactMatch = hostExact
+		params = hostParams
 
 	// case 4: We found a route for both hosts, but DefaultHost route was an exact match
 	// Selected route: DefaultHost
 	case defaultFound && defaultExact && hostFound && !hostExact:
 		pathRouteMatch = defaultMatch
 		exactMatch = defaultExact
+		params = defaultParams
 
 	// case 5: we found a route for both hosts, and both were an exact match
 	// Selected route: Host
 	case defaultFound && defaultExact && hostFound && hostExact:
 		pathRouteMatch = hostMatch
 		exactMatch = hostExact
+		params = hostParams
 
 	// case 6: we found a route for both hosts, and both were not an exact match
 	// Selected route: Host
 	case defaultFound && !defaultExact && hostFound && !hostExact:
 		pathRouteMatch = hostMatch
 		exactMatch = hostExact
+		params = hostParams
 
 	// case 7: we didn't found any route
 	// Selected route: none, we return a 404 HTTP Not Found error
 	default:
-		return methodRoute{}, []Middleware{}, 404
+		return routeMatch{status: 404}
+	}
+
+	match := routeMatch{
+		pathRoute: pathRouteMatch,
+		params:    params,
+		exact:     exactMatch,
 	}
 
 	// We have found a pathRoute. We now search for a methodRoute that matches the
 	// method of the request.
 	methodRouteMatch, ok := pathRouteMatch.subRoutes[method]
 
+	// HEAD requests are served by the GET route, if HEAD isn't registered
+	if !ok && sr.AutoMethods && method == "HEAD" {
+		methodRouteMatch, ok = pathRouteMatch.subRoutes["GET"]
+	}
+
+	// OPTIONS requests are answered by the router, if OPTIONS isn't registered
+	if !ok && sr.AutoMethods && method == "OPTIONS" && len(pathRouteMatch.subRoutes) > 0 {
+		methodRouteMatch, ok = optionsRoute(pathRouteMatch), true
+	}
+
 	// We have found a route with matching host and path, but the method wasn't found.
-	// we return an empty method route with a 405 Method  not allowed status code.
+	// we return the match without method route with a 405 Method  not allowed status code.
 	if !ok {
-		return methodRoute{}, []Middleware{}, 405
+		match.status = 405
+		match.allow = allowedMethods(pathRouteMatch)
+		return match
 	}
 
+	// Select the route of the method matching the predicates of the request. If no route
+	// matches, we return the match without method route with a 404 Not Found status code.
+	if methodRouteMatch, ok = methodRouteMatch.matchRequest(r); !ok {
+		match.status = 404
+		return match
+	}
+
+	match.methodRoute = methodRouteMatch
+
 	// We have found a route with matching host, path and method. The request
-	// Content-Type is not allowed. We return an empty method route with a
+	// Content-Type is not allowed. We return the match with a
 	// 406 Media not allowed status code.
 	if !methodRouteMatch.contentAllowed(contentType) {
-		return methodRoute{}, []Middleware{}, 406
+		match.status = 406
+		return match
 	}
 
 	// All criteria have matched: host, path, method and Content-Type. If the
@@ -117,80 +178,136 @@ func (sr *SRouter) getRoute(host, path, method, contentType string) (methodRoute
 	// the subpath. We do this on this level because we allow different fallback rules
 	// for each methodRoute
 	if !exactMatch && !methodRouteMatch.pathFallback {
-		return methodRoute{}, []Middleware{}, 404
+		match.status = 404
+		return match
 	}
 
-	// We got a winner, return the found methodRoute with a 200 OK status code
-	return methodRouteMatch, pathRouteMatch.middleware, 200
+	// All criteria have matched, but the route can't produce a media type the
+	// client accepts. We return the match with a 406 Not Acceptable status code.
+	if len(methodRouteMatch.produces) > 0 {
+		match.mediaType = negotiate(accept, methodRouteMatch.produces)
+		if match.mediaType == "" {
+			match.status = 406
+			return match
+		}
+	}
+
+	// We got a winner, return the match with a 200 OK status code
+	match.status = 200
+	return match
 
 }
 
-// Function to match a route for a given host + path combination
-func (sr *SRouter) matchRoute(host, urlPath string) (bool, bool, pathRoute) {
+// Function to match a route for a given host + path combination. The tree of the host
+// resolves exact matches, fallback to a parent path and fallback to the root path in a single traversal.
+func (sr *SRouter) matchRoute(host, urlPath string) (bool, bool, pathRoute, RouteParams) {
 
-	var pathRouteMatch pathRoute
+	tree, ok := sr.trees[host]
+	if !ok {
+		return false, false, pathRoute{}, nil
+	}
 
-	// Set exact match to false
-	var exactMatch bool
-	var match bool
+	var match, exactMatch bool
+	var route *pathRoute
+	var params RouteParams
 
-	for {
+	// A trailing slash is part of the canonical form, it doesn't select a different route
+	policy := sr.normalizePolicy(host)
+	if policy.TrailingSlash != TrailingSlashKeep && urlPath != "/" {
+		urlPath = strings.TrimSuffix(urlPath, "/")
+	}
 
-		// Search for an exact host+path match
-		if route, ok := sr.routes[host+urlPath]; ok {
-			match = true
-			exactMatch = true
-			pathRouteMatch = route
-			break
-		}
+	if policy.CaseInsensitive {
+		match, exactMatch, route, params = tree.lookupFold(urlPath)
+	} else {
+		match, exactMatch, route, params = tree.lookup(urlPath)
+	}
+	if !match {
+		return false, false, pathRoute{}, nil
+	}
 
-		// We haven't found an exact match, so we search for a subpath. For example:
-		// request has path /foo/bar. The path /foo/bar doesn't exist. So we search if
-		// the path /foo exists. We don't bother with fallback allowance just yet.
-		for pa := urlPath; pa != "/"; pa = path.Dir(pa) {
-			if route, ok := sr.routes[host+pa]; ok {
-				match = true
-				exactMatch = false
-				pathRouteMatch = route
-				break
-			}
-		}
+	return match, exactMatch, *route, params
+}
+
+// optionsRoute returns a methodRoute answering OPTIONS requests for pathRoute pr with the allowed
+// methods. Fallback is allowed if any of the methodRoutes of pr allows fallback.
+func optionsRoute(pr pathRoute) methodRoute {
+
+	allow := allowedMethods(pr)
+
+	mr := methodRoute{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		host:    pr.host,
+		path:    pr.path,
+		method:  "OPTIONS",
+		content: "*",
+	}
 
-		if match {
-			break
+	mr.chain = wrapMiddleware(mr.handler, pr.chain)
+
+	for _, sub := range pr.subRoutes {
+		mr.pathFallback = mr.pathFallback || sub.pathFallback
+		for _, v := range sub.variants {
+			mr.pathFallback = mr.pathFallback || v.pathFallback
 		}
+	}
+
+	return mr
+}
+
+// allowedMethods returns the sorted, comma separated methods allowed for pathRoute pr,
+// including the methods answered automatically by the router.
+func allowedMethods(pr pathRoute) string {
 
-		// We haven't found a sub path, so as a last resort we check if a root path exists.
-		if route, ok := sr.routes[host+"/"]; ok {
-			match = true
-			exactMatch = false
-			pathRouteMatch = route
-			break
+	methods := make([]string, 0, len(pr.subRoutes)+2)
+	for mtd := range pr.subRoutes {
+		methods = append(methods, mtd)
+	}
+
+	if _, ok := pr.subRoutes["GET"]; ok {
+		if _, ok := pr.subRoutes["HEAD"]; !ok {
+			methods = append(methods, "HEAD")
 		}
+	}
 
-		// We haven't found anything so we break
-		break
+	if _, ok := pr.subRoutes["OPTIONS"]; !ok && len(pr.subRoutes) > 0 {
+		methods = append(methods, "OPTIONS")
 	}
 
-	return match, exactMatch, pathRouteMatch
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
 
+// contentAllowed reports whether the Content-Type of a request matches one of the
+// Content-Type rules of the method route. Parameters of the Content-Type are only
+// compared if a rule constrains them.
 func (mr *methodRoute) contentAllowed(contentType string) bool {
 
 	if mr.content == "*" {
 		return true
 	}
 
-	if strings.IndexByte(contentType, ';') > -1 {
-		contentType = strings.Split(contentType, ";")[0]
-	}
-
-	if strings.IndexByte(mr.content, ';') > -1 {
-		for _, v := range strings.Split(mr.content, ";") {
-			if v == contentType {
+	if contentType == "" {
+		for _, rule := range mr.contentRules {
+			if rule.Type == "" {
 				return true
 			}
 		}
+		return false
+	}
+
+	ct, err := ParseMediaRange(contentType)
+	if err != nil || ct.IsWildcard() {
+		return false
+	}
+
+	for _, rule := range mr.contentRules {
+		if rule.Type != "" && rule.Match(ct) {
+			return true
+		}
 	}
-	return mr.content == contentType
+	return false
 }
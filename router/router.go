@@ -16,8 +16,10 @@
 package router
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 )
 
@@ -60,9 +62,23 @@ var (
 // Example: the request contains a request for /foo/bar, but /foo/bar is not registered as a route.
 // router.SRouter will dispatch that request to /foo route if that route is registered and supports fallback.
 //
+// Paths can contain named parameters, for example /users/:id, and a catch-all parameter as
+// the last segment, for example /files/*rest. Captured values can be retrieved by handlers
+// with router.Param. Exact paths take precedence over paths containing parameters.
+//
+// Hosts can be host patterns, for example *.example.com or {tenant}.api.example.com.
+// Routes are matched for the exact host first, then for host patterns and finally for DefaultHost.
+//
+// Routes can be added and removed while the router is serving requests. A complete route table can be
+// built off to the side in a separate router and swapped in atomically with ReplaceRoutes.
 type SRouter struct {
-	mu     sync.RWMutex
-	routes map[string]pathRoute
+	mu               sync.RWMutex
+	trees            map[string]*node
+	hostPatterns     []string
+	globalMiddleware []Middleware
+	hostMiddleware   map[string][]Middleware
+	hostNormalize    map[string]NormalizePolicy
+	customMethods    map[string]struct{}
 
 	// ErrorHandler allows to define a custom handler for errors. It takes ErrorHandler as type,
 	// which implements the http.Error function (w http.ResponseWriter, error string, code int).
@@ -70,6 +86,15 @@ type SRouter struct {
 
 	// WebDAV. If enabled, the router allows WebDAV methods to be registered as routes
 	WebDAV bool
+
+	// AutoMethods. If enabled, the router answers OPTIONS requests for paths that don't have an OPTIONS route,
+	// serves HEAD requests with the GET route of a path that doesn't have a HEAD route, and sets the Allow
+	// header on every 405 error. AutoMethods is enabled by NewRouter.
+	AutoMethods bool
+
+	// Normalize is the path normalization policy of hosts without their own policy, see SetNormalizePolicy.
+	// The default policy serves requests in place, with the path cleaned of dot segments and duplicate slashes.
+	Normalize NormalizePolicy
 }
 
 // ErrorHandler is a type of func(w http.ResponseWriter, r *http.Request, code int) where code
@@ -80,6 +105,7 @@ type ErrorHandler func(w http.ResponseWriter, r *http.Request, code int)
 // NewRouter returns a default router.SRouter
 func NewRouter() *SRouter {
 	return &SRouter{
+		AutoMethods: true,
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, code int) {
 			switch code {
 			case 404:
@@ -97,27 +123,56 @@ func NewRouter() *SRouter {
 // Parameters:
 //
 // 1. Host as string. You should use router.DefaultHost if you do not want to use a custom host.
+// The host can be a host pattern, in which a label is either a wildcard (*.example.com)
+// or a named label which is captured like a path parameter ({tenant}.example.com).
 //
 // 2. path as string. Every path should start with a /
+// The path can contain named parameters (/users/:id) and a catch-all parameter as
+// last segment (/files/*rest). A named parameter matches a single non-empty path segment,
+// a catch-all parameter matches the remainder of the path.
 //
 // 3. path fallback as bool.
 //
-// 4. method as string. This can only be one single HTTP method
+// 4. method as string. This can only be one single HTTP method. Methods other than the default
+// HTTP methods must be registered first with RegisterMethod, WebDAV methods require the WebDAV field.
 //
 // 5. Content-Type. This allows multiple entries, separated by semicolon. For example "text/html;application/json"
 // An empty Content-Type can also be valid, use a single semicolon to do so. For example ";"
-// Character sets are not checked by router.SRouter so you do not have to define these explicitly
+// Entries can contain wildcards, like "application/*" or "application/*+json", and are compared case insensitive.
+// Parameters of the request Content-Type, like charset, are only checked if the entry contains them.
+// For example "text/plain;charset=utf-8;multipart/form-data". Use "*" to allow any Content-Type.
 //
 // 6. handler of type http.Handler or http.HandlerFunc. The http.HandlerFunc does implement the http.Handler interface
 // and can therefore be passed into AddRoute as well.
+//
+// AddRoute calls log.Fatal if the route is invalid, use TryAddRoute to handle the error instead.
 func (sr *SRouter) AddRoute(host, path string, fallback bool, method, content string, handler http.Handler) {
+	if err := sr.TryAddRoute(host, path, fallback, method, content, handler); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// TryAddRoute is like AddRoute, but returns a *RouteError if the route is invalid
+func (sr *SRouter) TryAddRoute(host, path string, fallback bool, method, content string, handler http.Handler) error {
 
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
+	return routeError("AddRoute", host, path, method, sr.addRoute(host, path, fallback, method, content, handler, nil))
+}
+
+// addRoute adds a route to the router, as part of route group g. The group is nil for routes
+// added directly to the router. A route with predicates is added as variant of the method route.
+// This should only be called when the router is already locked.
+func (sr *SRouter) addRoute(host, path string, fallback bool, method, content string, handler http.Handler, g *RouteGroup, predicates ...Predicate) error {
+
 	// We don't want empty parameters
 	if host == "" || path == "" || method == "" {
-		panic("router: found illegal blank parameters")
+		return ErrBlankParameter
+	}
+
+	if path[0] != '/' {
+		return ErrNoLeadingSlash
 	}
 
 	// If the path is not the root, we don't want paths ending with a "/"
@@ -126,37 +181,38 @@ func (sr *SRouter) AddRoute(host, path string, fallback bool, method, content st
 		path = path[:len(path)-1]
 	}
 
-	// Test validity of HTTP methods
-	_, methodHTTPAllowed := allowedMethodsHTTP[method]
-	_, methodWebDAVAllowed := allowedMethodsHTTPWebDAV[method]
+	// Parameters in the path must be well formed
+	if isPattern(path) && !validPattern(path) {
+		return ErrInvalidPath
+	}
 
-	switch {
-	case sr.WebDAV:
-		if !methodWebDAVAllowed && !methodHTTPAllowed {
-			log.Fatalf("router: method %s is not allowed", method)
-		}
-	default:
-		if !methodHTTPAllowed {
-			log.Fatalf("router: method %s is not allowed", method)
-		}
+	// Host patterns must be well formed
+	if IsHostPattern(host) && !validHostPattern(host) {
+		return ErrInvalidHost
 	}
 
-	// Handler cannot be nil. This is rare, but we check anyway.
-	if handler == nil {
-		log.Fatalf("router: nil handler")
+	// Test validity of HTTP methods
+	if !sr.methodAllowed(method) {
+		return ErrMethodNotAllowed
 	}
 
-	if sr.routes == nil {
-		sr.routes = make(map[string]pathRoute)
+	// Handler cannot be nil. This is rare, but we check anyway.
+	if handler == nil {
+		return ErrNilHandler
 	}
 
-	pathRouteAdd := pathRoute{
-		subRoutes:  make(map[string]methodRoute),
-		middleware: []Middleware{},
+	// Content-Type rules must be well formed
+	var contentRules []MediaRange
+	if content != "*" {
+		var err error
+		if contentRules, err = parseContentRules(content); err != nil {
+			return fmt.Errorf("%w %s: %v", ErrInvalidContentType, content, err)
+		}
 	}
 
-	if _, ok := sr.routes[host+path]; !ok {
-		sr.routes[host+path] = pathRouteAdd
+	pathRouteAdd := sr.addPathRoute(host, path)
+	if pathRouteAdd == nil {
+		return ErrPathConflict
 	}
 
 	methodRouteAdd := methodRoute{
@@ -166,45 +222,115 @@ func (sr *SRouter) AddRoute(host, path string, fallback bool, method, content st
 		pathFallback: fallback,
 		method:       method,
 		content:      content,
+		contentRules: contentRules,
+		group:        g,
+		predicates:   predicates,
+	}
+
+	entry, ok := pathRouteAdd.subRoutes[method]
+
+	// A route without predicates replaces the method route, but keeps its variants
+	if len(predicates) == 0 {
+		methodRouteAdd.variants = entry.variants
+		pathRouteAdd.subRoutes[method] = methodRouteAdd
+		sr.composeRoute(pathRouteAdd)
+		return nil
+	}
+
+	// A route with predicates is added as variant. If there is no method route yet,
+	// a method route without handler holds the variant.
+	if !ok {
+		entry = methodRoute{host: host, path: path, method: method}
 	}
 
-	sr.routes[host+path].subRoutes[method] = methodRouteAdd
+	variants := make([]methodRoute, 0, len(entry.variants)+1)
+	for _, v := range entry.variants {
+		if !samePredicates(v.predicates, predicates) {
+			variants = append(variants, v)
+		}
+	}
+	entry.variants = append(variants, methodRouteAdd)
+
+	pathRouteAdd.subRoutes[method] = entry
+	sr.composeRoute(pathRouteAdd)
+	return nil
+}
+
+// addPathRoute returns the pathRoute for the host + path combination, creating it if necessary.
+// It returns nil if the path conflicts with a parameter of an existing route.
+// This should only be called when the router is already locked.
+func (sr *SRouter) addPathRoute(host, path string) *pathRoute {
+
+	host = hostKey(host)
+	if sr.trees == nil {
+		sr.trees = make(map[string]*node)
+	}
+
+	if _, ok := sr.trees[host]; !ok {
+		sr.trees[host] = &node{}
+
+		if IsHostPattern(host) {
+			sr.addHostPattern(host)
+		}
+	}
+
+	n := sr.trees[host].insert(path)
+	if n == nil {
+		return nil
+	}
+
+	if n.route == nil {
+		n.route = &pathRoute{
+			host:       host,
+			path:       path,
+			subRoutes:  make(map[string]methodRoute),
+			middleware: []Middleware{},
+		}
+		sr.composeRoute(n.route)
+	}
+
+	return n.route
 }
 
 func (sr *SRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	host := StripHostPort(r.Host)
+	host := RouteHost(r)
+	escaped := r.URL.EscapedPath()
 	path := cleanPath(r.URL.Path)
 	method := r.Method
 	content := r.Header.Get("Content-Type")
 
 	r.URL.Path = path
 
-	methodRouteMatch, middleWare, status := sr.getRoute(host, path, method, content)
+	match := sr.getRoute(r, host, path, method, content, strings.Join(r.Header["Accept"], ","))
 
-	if status != 200 {
-		sr.ErrorHandler(w, r, status)
-		return
+	// The response depends on the Accept header if the route produces media types
+	if len(match.methodRoute.produces) > 0 {
+		w.Header().Add("Vary", "Accept")
 	}
 
-	// Handle middleware
-	lenMw := len(middleWare)
-	mwHandler := methodRouteMatch.handler
+	if match.status != 200 {
 
-	switch {
-
-	// We do some middleware execution magic right here
-	case lenMw > 0:
-		for i := lenMw - 1; i >= 0; i-- {
-			if i == 0 {
-				middleWare[i].MiddlewareHTTP(mwHandler).ServeHTTP(w, r)
-				return
-			}
-			mwHandler = middleWare[i].MiddlewareHTTP(mwHandler)
+		// Tell the client which methods are allowed
+		if match.status == 405 && sr.AutoMethods {
+			w.Header().Set("Allow", match.allow)
 		}
 
-	// Request can be handled by handler, so dispatch to defined handler
-	default:
-		methodRouteMatch.handler.ServeHTTP(w, r)
+		sr.ErrorHandler(w, r, match.status)
+		return
 	}
+
+	// Redirect or reject requests for a path that isn't canonical
+	if !sr.normalize(w, r, match, escaped) {
+		return
+	}
+
+	// Make captured route parameters available to middleware and handler
+	r = withParams(r, match.params)
+
+	// Make the negotiated media type available to middleware and handler
+	r = withMediaType(r, match.mediaType)
+
+	// Dispatch to the handler, wrapped in its middleware chain
+	match.methodRoute.chain.ServeHTTP(w, r)
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 )
 
@@ -199,3 +200,74 @@ func TestWebDAVMethods(t *testing.T) {
 	ro.WebDAV = true
 	ro.AddRoute("127.0.0.1", "/", false, "PROPFIND", "*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 }
+
+func TestAutoMethods(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", exampleHandler())
+	ro.AddRoute(DefaultHost, "/", false, "POST", "", exampleHandler())
+	ro.AddRoute(DefaultHost, "/api", true, "PUT", "", exampleHandler())
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"OPTIONS", "/", 204, "GET, HEAD, OPTIONS, POST"},
+		{"HEAD", "/", 200, ""},
+		{"DELETE", "/", 405, "GET, HEAD, OPTIONS, POST"},
+		{"OPTIONS", "/api/sub", 204, "OPTIONS, PUT"},
+		{"HEAD", "/api", 405, "OPTIONS, PUT"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(test.method, test.path, nil)
+		ro.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.path, test.status, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", test.method, test.path, test.allow, allow)
+		}
+	}
+
+	// Disabling AutoMethods restores plain 405 errors
+	ro.AutoMethods = false
+	for _, method := range []string{"OPTIONS", "HEAD"} {
+		w := httptest.NewRecorder()
+		ro.ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+		if w.Code != 405 || w.Header().Get("Allow") != "" {
+			t.Errorf("%s: expected a 405 without Allow header, got %d %q", method, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+// TestAutoMethodsConcurrent answers 405 requests while the methods of the path route change.
+// Run with -race to detect reads of the route outside the lock of the router.
+func TestAutoMethodsConcurrent(t *testing.T) {
+
+	ro := NewRouter()
+	ro.AddRoute(DefaultHost, "/", false, "GET", "", exampleHandler())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			ro.AddRoute(DefaultHost, "/", false, "POST", "", exampleHandler())
+			ro.RemoveRoute(DefaultHost, "/", "POST")
+		}
+	}()
+
+	for i := 0; i < 500; i++ {
+		w := httptest.NewRecorder()
+		ro.ServeHTTP(w, httptest.NewRequest("DELETE", "/", nil))
+		if w.Code != 405 || w.Header().Get("Allow") == "" {
+			t.Fatalf("expected a 405 with Allow header, got %d %q", w.Code, w.Header().Get("Allow"))
+		}
+	}
+	wg.Wait()
+}
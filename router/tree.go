@@ -0,0 +1,398 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import "strings"
+
+// node is a node of the compressed radix tree that holds the pathRoutes of a single host.
+// Static nodes hold a shared prefix of the registered paths. Named parameters and
+// catch-all parameters are held in dedicated child nodes, which can only follow a "/".
+type node struct {
+	path     string
+	indices  string
+	children []*node
+	param    *node
+	catchAll *node
+	route    *pathRoute
+}
+
+// staticLen returns the length of the static prefix of path p, up to the first parameter
+func staticLen(p string) int {
+	for i := 1; i < len(p); i++ {
+		if (p[i] == ':' || p[i] == '*') && p[i-1] == '/' {
+			return i
+		}
+	}
+	return len(p)
+}
+
+// isEmpty reports whether n holds neither a route nor child nodes
+func (n *node) isEmpty() bool {
+	return n.route == nil && len(n.children) == 0 && n.param == nil && n.catchAll == nil
+}
+
+// child returns the static child of n starting with byte c, or nil if it doesn't exist
+func (n *node) child(c byte) *node {
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == c {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// split splits a static node at position i. The remainder of the path and
+// everything attached to n is moved to a new child.
+func (n *node) split(i int) {
+	child := &node{
+		path:     n.path[i:],
+		indices:  n.indices,
+		children: n.children,
+		param:    n.param,
+		catchAll: n.catchAll,
+		route:    n.route,
+	}
+
+	n.path = n.path[:i]
+	n.indices = string(child.path[0])
+	n.children = []*node{child}
+	n.param = nil
+	n.catchAll = nil
+	n.route = nil
+}
+
+// insert walks the tree to the node of path p, creating nodes where necessary.
+// It returns nil if a parameter in p conflicts with a parameter already registered
+// at the same position, for example /users/:id and /users/:name.
+func (n *node) insert(p string) *node {
+
+	// A fresh node takes the static prefix of the path
+	if n.path == "" && n.isEmpty() {
+		n.path = p[:staticLen(p)]
+	}
+
+	// Find the longest common prefix. Static nodes never contain parameters,
+	// so the common prefix always ends before a parameter in p.
+	i := 0
+	for i < len(n.path) && i < len(p) && n.path[i] == p[i] {
+		i++
+	}
+
+	if i < len(n.path) {
+		n.split(i)
+	}
+
+	p = p[i:]
+
+	switch {
+	case p == "":
+		return n
+
+	case p[0] == ':':
+		end := strings.IndexByte(p, '/')
+		if end < 0 {
+			end = len(p)
+		}
+		name := p[1:end]
+
+		if n.param == nil {
+			n.param = &node{path: name}
+		}
+		if n.param.path != name {
+			return nil
+		}
+		if end == len(p) {
+			return n.param
+		}
+		return n.param.staticChild(p[end]).insert(p[end:])
+
+	case p[0] == '*':
+		if n.catchAll == nil {
+			n.catchAll = &node{path: p[1:]}
+		}
+		if n.catchAll.path != p[1:] {
+			return nil
+		}
+		return n.catchAll
+	}
+
+	return n.staticChild(p[0]).insert(p)
+}
+
+// staticChild returns the static child of n starting with byte c, creating it if necessary
+func (n *node) staticChild(c byte) *node {
+	if child := n.child(c); child != nil {
+		return child
+	}
+	child := &node{}
+	n.indices += string(c)
+	n.children = append(n.children, child)
+	return child
+}
+
+// searcher holds the state of a single lookup in the tree
+type searcher struct {
+	path     string
+	fold     bool
+	params   RouteParams
+	fallback *pathRoute
+	fbParams RouteParams
+	fbLen    int
+}
+
+// lookup searches the tree for path p. It returns the pathRoute that matches p exactly,
+// or the pathRoute of the longest parent path of p and the root path as fallback.
+// Static paths take precedence over named parameters, named parameters over catch-all parameters.
+// A lookup in a tree without parameters doesn't allocate.
+func (n *node) lookup(p string) (bool, bool, *pathRoute, RouteParams) {
+	return n.search(p, false)
+}
+
+// lookupFold is like lookup, but matches the static parts of the paths in the tree
+// case insensitive. Only ASCII letters are folded.
+func (n *node) lookupFold(p string) (bool, bool, *pathRoute, RouteParams) {
+	return n.search(p, true)
+}
+
+// search searches the tree for path p, see lookup
+func (n *node) search(p string, fold bool) (bool, bool, *pathRoute, RouteParams) {
+
+	s := searcher{path: p, fold: fold}
+
+	if route := s.static(n, 0); route != nil {
+		return true, true, route, s.params
+	}
+
+	if s.fallback != nil {
+		return true, false, s.fallback, s.fbParams
+	}
+
+	return false, false, nil, nil
+}
+
+// static matches static node n, starting at position pos of the request path
+func (s *searcher) static(n *node, pos int) *pathRoute {
+
+	p := s.path[pos:]
+
+	if !s.hasPrefix(p, n.path) {
+
+		// The path ends right before the slash of a catch-all parameter,
+		// for example /files for /files/*rest.
+		if n.catchAll != nil && len(n.path) == len(p)+1 && n.path[len(p)] == '/' && s.hasPrefix(n.path, p) {
+			return s.capture(n.catchAll, "")
+		}
+		return nil
+	}
+
+	pos += len(n.path)
+	rest := s.path[pos:]
+
+	if rest == "" {
+		if n.route != nil {
+			return n.route
+		}
+		if n.catchAll != nil {
+			return s.capture(n.catchAll, "")
+		}
+		if c := n.child('/'); c != nil && c.path == "/" && c.catchAll != nil {
+			return s.capture(c.catchAll, "")
+		}
+		return nil
+	}
+
+	// A route ending at a segment boundary, or the root, can be used as fallback
+	if n.route != nil && (rest[0] == '/' || pos == 1) {
+		s.candidate(n.route, pos)
+	}
+
+	if c := n.child(rest[0]); c != nil {
+		if route := s.static(c, pos); route != nil {
+			return route
+		}
+	}
+
+	// The static child of the other case, if the lookup is case insensitive
+	if s.fold {
+		if c := n.child(swapCase(rest[0])); c != nil && swapCase(rest[0]) != rest[0] {
+			if route := s.static(c, pos); route != nil {
+				return route
+			}
+		}
+	}
+
+	if n.param != nil {
+		if route := s.param(n.param, pos); route != nil {
+			return route
+		}
+	}
+
+	if n.catchAll != nil {
+		return s.capture(n.catchAll, rest)
+	}
+
+	return nil
+}
+
+// param matches named parameter node n, starting at position pos of the request path
+func (s *searcher) param(n *node, pos int) *pathRoute {
+
+	rest := s.path[pos:]
+	end := strings.IndexByte(rest, '/')
+	if end < 0 {
+		end = len(rest)
+	}
+
+	// A named parameter never matches an empty segment
+	if end == 0 {
+		return nil
+	}
+
+	s.params = append(s.params, RouteParam{Key: n.path, Value: rest[:end]})
+	pos += end
+
+	if pos == len(s.path) && n.route != nil {
+		return n.route
+	}
+
+	if pos < len(s.path) && n.route != nil {
+		s.candidate(n.route, pos)
+	}
+
+	if c := n.child('/'); c != nil {
+		if route := s.static(c, pos); route != nil {
+			return route
+		}
+	}
+
+	s.params = s.params[:len(s.params)-1]
+	return nil
+}
+
+// hasPrefix reports whether p begins with prefix, ignoring the case of ASCII letters if the lookup is case insensitive
+func (s *searcher) hasPrefix(p, prefix string) bool {
+	if !s.fold {
+		return strings.HasPrefix(p, prefix)
+	}
+	if len(p) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if p[i] != prefix[i] && swapCase(p[i]) != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// swapCase returns the other case of ASCII letter c. Other bytes are returned unchanged.
+func swapCase(c byte) byte {
+	switch {
+	case 'a' <= c && c <= 'z':
+		return c - 'a' + 'A'
+	case 'A' <= c && c <= 'Z':
+		return c - 'A' + 'a'
+	}
+	return c
+}
+
+// capture matches catch-all parameter node n with the remainder of the request path
+func (s *searcher) capture(n *node, value string) *pathRoute {
+	if n.route == nil {
+		return nil
+	}
+	s.params = append(s.params, RouteParam{Key: n.path, Value: value})
+	return n.route
+}
+
+// candidate registers a fallback route, ending at position pos of the request path.
+// The longest candidate wins, of candidates with the same length the first one wins.
+func (s *searcher) candidate(route *pathRoute, pos int) {
+	if s.fallback != nil && s.fbLen >= pos {
+		return
+	}
+	s.fallback = route
+	s.fbLen = pos
+	s.fbParams = append(s.fbParams[:0], s.params...)
+}
+
+// find returns the node holding path p, or nil if p isn't part of the tree
+func (n *node) find(p string) *node {
+
+	if !strings.HasPrefix(p, n.path) {
+		return nil
+	}
+
+	p = p[len(n.path):]
+
+	switch {
+	case p == "":
+		return n
+
+	case p[0] == ':':
+		end := strings.IndexByte(p, '/')
+		if end < 0 {
+			end = len(p)
+		}
+		if n.param == nil || n.param.path != p[1:end] {
+			return nil
+		}
+		if end == len(p) {
+			return n.param
+		}
+		if c := n.param.child(p[end]); c != nil {
+			return c.find(p[end:])
+		}
+		return nil
+
+	case p[0] == '*':
+		if n.catchAll == nil || n.catchAll.path != p[1:] {
+			return nil
+		}
+		return n.catchAll
+	}
+
+	if c := n.child(p[0]); c != nil {
+		return c.find(p)
+	}
+	return nil
+}
+
+// prune removes all nodes without routes from the tree
+func (n *node) prune() {
+
+	for i := 0; i < len(n.children); {
+		n.children[i].prune()
+
+		if !n.children[i].isEmpty() {
+			i++
+			continue
+		}
+
+		n.children = append(n.children[:i], n.children[i+1:]...)
+		n.indices = n.indices[:i] + n.indices[i+1:]
+	}
+
+	if n.param != nil {
+		n.param.prune()
+		if n.param.isEmpty() {
+			n.param = nil
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.route == nil {
+		n.catchAll = nil
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import "testing"
+
+func TestTreeLookup(t *testing.T) {
+
+	tree := &node{}
+	paths := []string{"/", "/foo", "/foo/bar", "/foobar", "/users/:id", "/users/:id/posts", "/files/*rest"}
+	routes := make(map[string]*pathRoute)
+
+	for _, p := range paths {
+		n := tree.insert(p)
+		n.route = &pathRoute{}
+		routes[p] = n.route
+	}
+
+	tests := []struct {
+		path  string
+		route string
+		exact bool
+		param string
+	}{
+		{"/", "/", true, ""},
+		{"/foo", "/foo", true, ""},
+		{"/foo/", "/foo", false, ""},
+		{"/foo/bar", "/foo/bar", true, ""},
+		{"/foo/bar/baz", "/foo/bar", false, ""},
+		{"/foobar", "/foobar", true, ""},
+		{"/foob", "/", false, ""},
+		{"/unknown/path", "/", false, ""},
+		{"/users/42", "/users/:id", true, "42"},
+		{"/users/42/", "/users/:id", false, "42"},
+		{"/users/42/posts", "/users/:id/posts", true, "42"},
+		{"/users/42/posts/1", "/users/:id/posts", false, "42"},
+		{"/users/42/comments", "/users/:id", false, "42"},
+		{"/users", "/", false, ""},
+		{"/files", "/files/*rest", true, ""},
+		{"/files/a/b", "/files/*rest", true, "a/b"},
+	}
+
+	for _, test := range tests {
+		match, exact, route, params := tree.lookup(test.path)
+		if !match {
+			t.Errorf("%s: no match", test.path)
+			continue
+		}
+		if route != routes[test.route] {
+			t.Errorf("%s: matched wrong route, expected %s", test.path, test.route)
+		}
+		if exact != test.exact {
+			t.Errorf("%s: expected exact match to be %t", test.path, test.exact)
+		}
+		if len(params) > 0 && params[0].Value != test.param {
+			t.Errorf("%s: expected parameter %q, got %q", test.path, test.param, params[0].Value)
+		}
+	}
+}
+
+func TestTreeConflict(t *testing.T) {
+	tree := &node{}
+	if tree.insert("/users/:id") == nil {
+		t.Fatal("insert of /users/:id failed")
+	}
+	if tree.insert("/users/:name/posts") != nil {
+		t.Error("expected conflict for /users/:name/posts")
+	}
+	if tree.insert("/users/:id/posts") == nil {
+		t.Error("insert of /users/:id/posts failed")
+	}
+}
+
+func TestTreeNoRoot(t *testing.T) {
+	tree := &node{}
+	tree.insert("/foo").route = &pathRoute{}
+
+	if match, _, _, _ := tree.lookup("/bar"); match {
+		t.Error("/bar should not match without a root route")
+	}
+}
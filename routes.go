@@ -0,0 +1,111 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/redmaner/MaguroHTTP/router"
+	"github.com/redmaner/MaguroHTTP/tuna"
+)
+
+// showRoutes loads the configuration and prints the registered routes. If a host and path
+// are supplied, it explains how a request for that host and path would be routed instead.
+// The method defaults to GET, the Content-Type and Accept header default to empty.
+func showRoutes(config string, args []string) {
+
+	sr := tuna.NewRouterFromConfig(config)
+
+	if len(args) < 2 {
+		printRoutes(sr)
+		return
+	}
+
+	method := "GET"
+	if len(args) > 2 {
+		method = args[2]
+	}
+
+	var contentType string
+	if len(args) > 3 {
+		contentType = args[3]
+	}
+
+	var accept string
+	if len(args) > 4 {
+		accept = args[4]
+	}
+
+	printExplanation(sr.Explain(args[0], args[1], method, contentType, accept))
+}
+
+func printRoutes(sr *router.SRouter) {
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tPATH\tMETHOD\tCONTENT-TYPE\tFALLBACK\tPREDICATES\tMIDDLEWARE")
+
+	sr.Routes(func(rt router.Route) bool {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%q\t%t\t%s\t%s\n", rt.Host, rt.Path, rt.Method, rt.Content, rt.Fallback, strings.Join(rt.Predicates, "; "), strings.Join(rt.Middleware, ", "))
+		return true
+	})
+
+	tw.Flush()
+}
+
+func printExplanation(e router.RouteExplanation) {
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Status:\t%d\n", e.Status)
+	if e.Location != "" {
+		fmt.Fprintf(tw, "Location:\t%s\n", e.Location)
+	}
+
+	if e.Path == "" {
+		fmt.Fprintf(tw, "Path route:\tnone\n")
+		tw.Flush()
+		return
+	}
+
+	fmt.Fprintf(tw, "Path route:\t%s %s\n", e.Host, e.Path)
+	fmt.Fprintf(tw, "Fallback used:\t%t\n", e.Fallback)
+	fmt.Fprintf(tw, "Methods:\t%s\n", strings.Join(e.Methods, ", "))
+
+	if e.Route != nil {
+		fmt.Fprintf(tw, "Method route:\t%s Content-Type=%q fallback=%t\n", e.Route.Method, e.Route.Content, e.Route.Fallback)
+		if len(e.Route.Predicates) > 0 {
+			fmt.Fprintf(tw, "Predicates:\t%s\n", strings.Join(e.Route.Predicates, "; "))
+		}
+		if e.Route.Produces != "" {
+			fmt.Fprintf(tw, "Produces:\t%s\n", e.Route.Produces)
+			fmt.Fprintf(tw, "Media type:\t%s\n", e.MediaType)
+		}
+	} else {
+		fmt.Fprintf(tw, "Method route:\tnone\n")
+	}
+
+	for _, p := range e.Params {
+		fmt.Fprintf(tw, "Param:\t%s=%s\n", p.Key, p.Value)
+	}
+
+	for i, mw := range e.Middleware {
+		fmt.Fprintf(tw, "Middleware %d:\t%s\n", i+1, mw)
+	}
+
+	tw.Flush()
+}
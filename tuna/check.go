@@ -0,0 +1,402 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Report holds the errors and warnings found by CheckConfig. Errors make the configuration
+// invalid, warnings point at settings that are ignored or probably don't work as intended.
+type Report struct {
+	Errors   []*ConfigError
+	Warnings []*ConfigError
+}
+
+func (r *Report) addError(err *ConfigError) {
+	r.Errors = append(r.Errors, err)
+}
+
+func (r *Report) addWarning(err *ConfigError) {
+	r.Warnings = append(r.Warnings, err)
+}
+
+// sortFrom sorts the errors and warnings added after the first errors and warnings by file, line
+// and field, so the problems of a file and the files it includes are reported in a stable order
+func (r *Report) sortFrom(errors, warnings int) {
+	for _, list := range [][]*ConfigError{r.Errors[errors:], r.Warnings[warnings:]} {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].File != list[j].File {
+				return list[i].File < list[j].File
+			}
+			if list[i].Line != list[j].Line {
+				return list[i].Line < list[j].Line
+			}
+			return list[i].Field < list[j].Field
+		})
+	}
+}
+
+// CheckConfig checks the configuration file p and the configuration files of its vhosts, and returns
+// every error and warning it finds. Unlike loading the configuration, it reports unknown or misspelled
+// keys and values of the wrong type, with the file, line and key path. If the configuration is valid,
+// the routes are built to report errors in routes as well.
+func CheckConfig(p string) *Report {
+
+	r := &Report{}
+
+	cfg := NewConfig()
+	errs := len(r.Errors)
+	list, inline := r.checkFile(p, reflect.TypeOf(cfg))
+	if list == nil || !r.decode(p, &cfg, list, errs) {
+		return r
+	}
+	if err := addInlineVhosts(p, &cfg, inline); err != nil {
+		r.addError(err.(*ConfigError))
+	}
+	cfg.validate(p, false, r)
+
+	if cfg.Core.VirtualHosting {
+		vhosts := make([]string, 0, len(cfg.Core.VirtualHosts))
+		for vhost := range cfg.Core.VirtualHosts {
+			vhosts = append(vhosts, vhost)
+		}
+		sort.Strings(vhosts)
+
+		configs := make(map[string]Config, len(vhosts))
+		for _, vhost := range vhosts {
+			if vcfg, ok := r.checkVhost(vhost, cfg, inline); ok {
+				configs[vhost] = vcfg
+			}
+		}
+		checkAliases(cfg, configs, inline, r)
+	}
+
+	// Building the routes reports conflicting routes and invalid Content-Types
+	if len(r.Errors) == 0 {
+		if _, err := TryNewRouterFromConfig(p); err != nil {
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) {
+				cerr = &ConfigError{File: p, Err: err}
+			}
+			r.addError(cerr)
+		}
+	}
+
+	return r
+}
+
+// checkFile checks the keys and values of configuration file p against type t. It returns the parsed
+// file and the vhosts it declares inline, or a nil list if the file could not be loaded.
+func (r *Report) checkFile(p string, t reflect.Type) (*ast.ObjectList, map[string]inlineVhost) {
+
+	errs, warnings := len(r.Errors), len(r.Warnings)
+	defer r.sortFrom(errs, warnings)
+
+	// Each file is checked on its own, so problems are reported with the file they are in
+	ld := configLoader{
+		visit: func(file string, list *ast.ObjectList) {
+			chk := checker{file: file, report: r}
+			chk.check("", list, t)
+		},
+	}
+	list := ld.load(p)
+	for _, err := range ld.errs {
+		r.addError(err)
+	}
+	if len(ld.errs) > 0 {
+		return nil, nil
+	}
+
+	return list, ld.vhosts
+}
+
+// decode decodes list of file p to c. It reports whether the list could be decoded.
+// errs is the amount of errors in the report before file p was checked.
+func (r *Report) decode(p string, c *Config, list *ast.ObjectList, errs int) bool {
+
+	// The decoder stops at the first value of the wrong type, which is already reported
+	if err := hcl.DecodeObject(c, list); err != nil {
+		if len(r.Errors) == errs {
+			r.addError(&ConfigError{File: p, Err: err})
+		}
+		return false
+	}
+	return true
+}
+
+// checkVhost checks the configuration of vhost host of main configuration c, declared inline or
+// in a vhost file, decodes it and validates it. It returns the configuration and reports whether
+// it could be decoded.
+func (r *Report) checkVhost(host string, c Config, inline map[string]inlineVhost) (Config, bool) {
+
+	errs, warnings := len(r.Errors), len(r.Warnings)
+	defer r.sortFrom(errs, warnings)
+
+	p := c.Core.VirtualHosts[host]
+	vhost, isInline := inline[host]
+	if isInline {
+		chk := checker{file: vhost.file, report: r}
+		chk.check(vhostKey+"."+host, vhost.list, reflect.TypeOf(vhostSettings{}))
+	} else {
+		if p == "" {
+			return Config{}, false
+		}
+		list, nested := r.checkFile(p, reflect.TypeOf(vhostSettings{}))
+		if list == nil {
+			return Config{}, false
+		}
+		if len(nested) > 0 {
+			r.addError(configError(p, vhostKey, "Vhost blocks can only be declared in the main configuration"))
+			return Config{}, false
+		}
+		vhost = inlineVhost{file: p, list: list}
+	}
+
+	// The decoder stops at the first value of the wrong type, which is already reported
+	vcfg, err := decodeVhost(vhost.file, vhost.list, c)
+	if err != nil {
+		if len(r.Errors) == errs {
+			if isInline {
+				err = vhostError(host, err)
+			}
+			r.addError(err.(*ConfigError))
+		}
+		return Config{}, false
+	}
+
+	validateVhost(host, p, &vcfg, c.Core, isInline, r)
+	return vcfg, true
+}
+
+// checker compares the keys and values of a parsed configuration file with the type
+// they are decoded to, following the rules of the HCL decoder
+type checker struct {
+	file   string
+	report *Report
+}
+
+func (chk *checker) errorf(field string, pos token.Pos, format string, a ...interface{}) {
+	err := configError(chk.file, field, format, a...)
+	err.Line = pos.Line
+	chk.report.addError(err)
+}
+
+// check checks node, found at key path field, against type t
+func (chk *checker) check(field string, node ast.Node, t reflect.Type) {
+
+	switch t.Kind() {
+	case reflect.Struct:
+		items, ok := objectItems(node)
+		if !ok {
+			chk.errorf(field, node.Pos(), "expected a block, got %s", describe(node))
+			return
+		}
+		for _, item := range items {
+			key := item.Keys[0]
+			name := key.Token.Value().(string)
+			sf, ok := structField(t, name)
+			if !ok {
+				if suggestion := suggestField(t, name); suggestion != "" {
+					chk.errorf(joinField(field, name), key.Pos(), "unknown key %q, did you mean %q?", name, suggestion)
+				} else {
+					chk.errorf(joinField(field, name), key.Pos(), "unknown key %q", name)
+				}
+				continue
+			}
+			chk.check(joinField(field, sf.Name), itemValue(item), sf.Type)
+		}
+
+	case reflect.Map:
+		items, ok := objectItems(node)
+		if !ok {
+			chk.errorf(field, node.Pos(), "expected a block of keys and values, got %s", describe(node))
+			return
+		}
+		for _, item := range items {
+			chk.check(joinField(field, item.Keys[0].Token.Value().(string)), itemValue(item), t.Elem())
+		}
+
+	case reflect.Slice:
+		switch n := node.(type) {
+		case *ast.ListType:
+			for i, elem := range n.List {
+				chk.check(fmt.Sprintf("%s[%d]", field, i), elem, t.Elem())
+			}
+		case *ast.ObjectType:
+			chk.check(field, n, t.Elem())
+		default:
+			chk.errorf(field, node.Pos(), "expected a list, got %s", describe(node))
+		}
+
+	case reflect.String:
+		if !isLiteral(node, token.STRING, token.HEREDOC, token.NUMBER) {
+			chk.errorf(field, node.Pos(), "expected a string, got %s", describe(node))
+		}
+
+	case reflect.Int, reflect.Int64:
+		if isLiteral(node, token.NUMBER) {
+			return
+		}
+		if lit, ok := node.(*ast.LiteralType); ok && lit.Token.Type == token.STRING {
+			if _, err := strconv.ParseInt(lit.Token.Value().(string), 0, 0); err == nil {
+				return
+			}
+		}
+		chk.errorf(field, node.Pos(), "expected a number, got %s", describe(node))
+
+	case reflect.Float64:
+		if !isLiteral(node, token.NUMBER, token.FLOAT) {
+			chk.errorf(field, node.Pos(), "expected a number, got %s", describe(node))
+		}
+
+	case reflect.Bool:
+		if !isLiteral(node, token.BOOL) {
+			chk.errorf(field, node.Pos(), "expected true or false, got %s", describe(node))
+		}
+	}
+}
+
+// objectItems returns the items of a block
+func objectItems(node ast.Node) ([]*ast.ObjectItem, bool) {
+	switch n := node.(type) {
+	case *ast.ObjectList:
+		return n.Items, true
+	case *ast.ObjectType:
+		return n.List.Items, true
+	}
+	return nil, false
+}
+
+// itemValue returns the value of item. An item with more than one key, like Core Metrics { ... },
+// is a nested block of the first key.
+func itemValue(item *ast.ObjectItem) ast.Node {
+	if len(item.Keys) == 1 {
+		return item.Val
+	}
+	nested := &ast.ObjectItem{Keys: item.Keys[1:], Val: item.Val}
+	return &ast.ObjectType{List: &ast.ObjectList{Items: []*ast.ObjectItem{nested}}}
+}
+
+// structField returns the field of struct type t named name. Like the decoder, names are
+// matched case-insensitively.
+func structField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); strings.EqualFold(sf.Name, name) {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestField returns the field of struct type t that name is probably a misspelling of,
+// or an empty string if no field is close enough
+func suggestField(t reflect.Type, name string) string {
+
+	best, bestDistance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		fieldName := t.Field(i).Name
+		if d := editDistance(strings.ToLower(name), strings.ToLower(fieldName)); d < bestDistance {
+			best, bestDistance = fieldName, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// isLiteral reports whether node is a literal of one of the token types
+func isLiteral(node ast.Node, types ...token.Type) bool {
+	lit, ok := node.(*ast.LiteralType)
+	if !ok {
+		return false
+	}
+	for _, t := range types {
+		if lit.Token.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns a description of node for error messages
+func describe(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.ObjectType, *ast.ObjectList:
+		return "a block"
+	case *ast.ListType:
+		return "a list"
+	case *ast.LiteralType:
+		switch n.Token.Type {
+		case token.BOOL:
+			return "a boolean"
+		case token.NUMBER, token.FLOAT:
+			return "a number"
+		default:
+			return "a string"
+		}
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+// joinField joins key path field and key name
+func joinField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
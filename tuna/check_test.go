@@ -0,0 +1,75 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const checkCore = `Core {
+  Port = "8080"
+  LogOut = "stdout"
+  FileDir = "/tmp/maguro/"
+`
+
+func TestCheckConfigDecodeError(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tuna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vhostFile := filepath.Join(dir, "vhost.hcl")
+	tests := []struct {
+		name   string
+		config string
+		field  string
+	}{
+		{"main", checkCore + `  ReadTimeout = "x"
+}
+Serve { ServeDir = "/tmp/", ServeIndex = "index.html" }`, "Core.ReadTimeout"},
+		{"inline", checkCore + `  VirtualHosting = true
+}
+Vhost "a.test" {
+  Serve { ServeDir = "/tmp/", ServeIndex = "index.html" }
+  Guard { RateBurst = "x" }
+}`, "Vhost.a.test.Guard.RateBurst"},
+		{"file", checkCore + `  VirtualHosting = true
+  VirtualHosts { "b.test" = "` + vhostFile + `" }
+}`, "Guard.RateBurst"},
+	}
+
+	vhost := `Serve { ServeDir = "/tmp/", ServeIndex = "index.html" }
+Guard { RateBurst = "x" }`
+	if err := ioutil.WriteFile(vhostFile, []byte(vhost), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		p := filepath.Join(dir, test.name+".hcl")
+		if err := ioutil.WriteFile(p, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := CheckConfig(p)
+		if len(r.Errors) != 1 || r.Errors[0].Field != test.field {
+			t.Errorf("%s: expected a single error for %s, got %v", test.name, test.field, r.Errors)
+		}
+	}
+}
@@ -15,12 +15,14 @@
 package tuna
 
 import (
-	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
 	"time"
 
-	"github.com/hashicorp/hcl"
+	"github.com/redmaner/MaguroHTTP/router"
 )
 
 // Config is type holding the main configurtion
@@ -30,6 +32,10 @@ type Config struct {
 	Errors map[string]string
 	Proxy  proxyConfig
 	Guard  guardConfig
+
+	// Aliases are hosts that are served by a vhost as if they were the host of the vhost,
+	// for example www.example.com for example.com. Aliases can be host patterns.
+	Aliases []string
 }
 
 // CoreConfig is part of the main configuration.
@@ -45,11 +51,28 @@ type CoreConfig struct {
 	ReadHeaderTimeout int
 	WriteTimeout      int
 
-	WebDAV         bool
+	// ReloadInterval is the interval in seconds at which the configuration files are
+	// checked for changes, and reloaded when they changed. 0 disables polling.
+	ReloadInterval int
+
+	WebDAV bool
+
+	// Methods are the custom HTTP methods, like PURGE, that can be used in Serve.Methods and
+	// Proxy.Methods in addition to the default HTTP methods, and WebDAV methods if WebDAV is enabled
+	Methods []string
+
 	VirtualHosting bool
 	VirtualHosts   map[string]string
-	TLS            TLSConfig
-	Metrics        MetricsConfig
+
+	// DefaultVhost is the vhost that serves requests for hosts that don't match a vhost or alias
+	DefaultVhost string
+
+	// UnknownHost is the response to requests for hosts that don't match a vhost or alias,
+	// if there is no DefaultVhost
+	UnknownHost UnknownHostConfig
+
+	TLS     TLSConfig
+	Metrics MetricsConfig
 }
 
 // TLSConfig holds information about TLS and is part of MaguroHTTP core config
@@ -81,6 +104,7 @@ type serveConfig struct {
 	ServeIndex string
 	Headers    map[string]string
 	Methods    map[string]string
+	Predicates map[string]string
 	MIMETypes  MIMETypes
 	Download   download
 }
@@ -106,10 +130,17 @@ type MIMETypes struct {
 
 // Proxy type, part of MaguroHTTP config
 type proxyConfig struct {
-	Enabled bool
-	Rules   map[string]string
-	Methods []string
-	Headers map[string]string
+	Enabled  bool
+	Rules    map[string]string
+	Methods  []string
+	Headers  map[string]string
+	Variants map[string][]proxyVariant
+}
+
+// proxyVariant routes proxy requests matching predicates When to another Target
+type proxyVariant struct {
+	When   string
+	Target string
 }
 
 // guardConfig
@@ -118,6 +149,10 @@ type guardConfig struct {
 	RateBurst  int
 	FilterOnIP bool
 
+	// Clients is the amount of clients the limiter of a host remembers. By default the
+	// limiter remembers up to 262144 clients.
+	Clients int
+
 	Firewall firewallConfig
 }
 
@@ -129,6 +164,14 @@ type firewallConfig struct {
 	Rules        map[string][]string
 }
 
+// UnknownHostConfig type, part of MaguroHTTP core config. Requests for unknown hosts are
+// answered with error Status, 404 by default, or redirected to Redirect with Status, 302
+// by default. The path and query of the request are added to Redirect.
+type UnknownHostConfig struct {
+	Status   int
+	Redirect string
+}
+
 // MetricsConfig type, part of MaguroHTTP config
 type MetricsConfig struct {
 	Enabled bool
@@ -169,60 +212,101 @@ func NewVhostConfig() Config {
 	}
 }
 
-// LoadConfigFromFile is a function which a loads the Config type microConfig from a json file
+// LoadConfigFromFile is a function which a loads the Config type microConfig from a json file.
+// It calls log.Fatal if the file cannot be loaded, use TryLoadConfigFromFile to handle the error instead.
 func LoadConfigFromFile(p string, c *Config) {
-
-	// check if config exists
-	if _, err := os.Stat(p); err != nil {
+	if err := TryLoadConfigFromFile(p, c); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// load config
-	file, err := os.Open(p)
-	if err != nil {
-		log.Fatal(err)
+// TryLoadConfigFromFile is like LoadConfigFromFile, but returns a *ConfigError if the file cannot be loaded.
+// Includes, environment variables and secret files in the configuration are resolved, see configLoader.
+// Vhosts declared inline with Vhost blocks are not loaded, they are loaded by New.
+func TryLoadConfigFromFile(p string, c *Config) error {
+	_, _, err := loadConfigFile(p, c)
+	return err
+}
+
+// Validate can be used to validate a Config type. It logs every error and calls log.Fatal
+// if the configuration is invalid, use TryValidate to handle the error instead.
+func (c *Config) Validate(p string, isVhost bool) {
+
+	var r Report
+	c.validate(p, isVhost, &r)
+
+	for i, err := range r.Errors {
+		if i == len(r.Errors)-1 {
+			log.Fatal(err)
+		}
+		log.Print(err)
 	}
+}
 
-	data, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Fatalf("%s: %v", p, err)
+// TryValidate is like Validate, but returns a *ConfigError for the first invalid field.
+// Use CheckConfig to get all errors and warnings of a configuration file.
+func (c *Config) TryValidate(p string, isVhost bool) error {
+
+	var r Report
+	c.validate(p, isVhost, &r)
+
+	if len(r.Errors) > 0 {
+		return r.Errors[0]
 	}
-	err = file.Close()
-	if err != nil {
-		log.Print(err)
+	return nil
+}
+
+// validate adds every error of the unknown host response in file p to report r
+func (u UnknownHostConfig) validate(p string, r *Report) {
+
+	if u.Redirect == "" {
+		switch u.Status {
+		case 0, 404, 421:
+		default:
+			r.addError(configError(p, "Core.UnknownHost.Status", "Status must be 404 or 421, or a redirect status with Redirect"))
+		}
+		return
 	}
 
-	err = hcl.Unmarshal(data, c)
-	if err != nil {
-		log.Fatalf("%s: %v", p, err)
+	switch u.Status {
+	case 0, 301, 302, 307, 308:
+	default:
+		r.addError(configError(p, "Core.UnknownHost.Status", "Status must be 301, 302, 307 or 308 to redirect"))
+	}
+	if target, err := url.Parse(u.Redirect); err != nil || target.Scheme == "" || target.Host == "" {
+		r.addError(configError(p, "Core.UnknownHost.Redirect", "Redirect must be an absolute URL"))
 	}
 }
 
-// Validate can be used to validate a Config type
-func (c *Config) Validate(p string, isVhost bool) {
+// validate adds every error and warning of the configuration in file p to report r
+func (c *Config) validate(p string, isVhost bool, r *Report) {
 
 	if !isVhost {
 		if c.Core.Port == "" {
-			log.Fatalf("%s: The server configuration has missing elements: check Port", p)
+			r.addError(configError(p, "Core.Port", "The server configuration has missing elements: check Port"))
 		}
 
 		// LogOut needs to be defined
 		if c.Core.LogOut == "" {
-			log.Fatalf("%s: LogOut is undefined", p)
+			r.addError(configError(p, "Core.LogOut", "LogOut is undefined"))
+		}
+
+		// ReloadInterval cannot be lower than zero
+		if c.Core.ReloadInterval < 0 {
+			r.addError(configError(p, "Core.ReloadInterval", "ReloadInterval must be 0 or higher"))
 		}
 
 		// LogLevel cannot be lower than zero
 		if c.Core.LogLevel < 0 {
-			log.Fatalf("%s: LogLevel must be higher than 0", p)
+			r.addError(configError(p, "Core.LogLevel", "LogLevel must be higher than 0"))
 		}
 
 		// FileDir must be defined
 		if c.Core.FileDir == "" || c.Core.FileDir == "/" {
-			log.Fatalf("%s: FileDir is not defined or is pointing to root", p)
-		}
+			r.addError(configError(p, "Core.FileDir", "FileDir is not defined or is pointing to root"))
+		} else if c.Core.FileDir[len(c.Core.FileDir)-1] != '/' {
 
-		// We automatically fix FileDir if it doesn't end with a slash
-		if c.Core.FileDir[len(c.Core.FileDir)-1] != '/' {
+			// We automatically fix FileDir if it doesn't end with a slash
 			c.Core.FileDir = c.Core.FileDir + "/"
 		}
 
@@ -234,55 +318,199 @@ func (c *Config) Validate(p string, isVhost bool) {
 
 				// Certificates need to be defined
 				if len(c.Core.TLS.AutoCert.Certificates) == 0 {
-					log.Fatalf("%s: TLS autocert is enabled but certificates are not defined", p)
+					r.addError(configError(p, "Core.TLS.AutoCert.Certificates", "TLS autocert is enabled but certificates are not defined"))
 				}
 
 				// Autocert only works in combination with https port (443)
 				if c.Core.Port != "443" {
-					log.Fatalf("%s: TLS autocert is enabled and cannot be used with a port different than 443 (HTTPS)", p)
+					r.addError(configError(p, "Core.Port", "TLS autocert is enabled and cannot be used with a port different than 443 (HTTPS)"))
 				}
-			} else {
+			} else if c.Core.TLS.TLSCert == "" || c.Core.TLS.TLSKey == "" {
 
 				// Autocert is disabled, so make sure custom certificate / key combination is defined
-				if c.Core.TLS.TLSCert == "" || c.Core.TLS.TLSKey == "" {
-					log.Fatalf("%s: TLS is enabled but certificates are not defined", p)
-				}
+				r.addError(configError(p, "Core.TLS", "TLS is enabled but certificates are not defined"))
+			}
+		}
+
+		// Test metrics
+		if c.Core.Metrics.Enabled {
+			if c.Core.Metrics.Path == "" {
+				r.addError(configError(p, "Core.Metrics.Path", "Metrics are enabled but Path is not defined"))
+			}
+			if len(c.Core.Metrics.Users) == 0 {
+				r.addWarning(configError(p, "Core.Metrics.Users", "Metrics are enabled without users, so the metrics page cannot be accessed"))
+			}
+			if !c.Core.TLS.Enabled {
+				r.addWarning(configError(p, "Core.Metrics.Enabled", "Metrics are only collected when TLS is enabled"))
 			}
 		}
+
+		// Custom methods are registered in the router, so they must be valid HTTP method names
+		for _, mtd := range c.Core.Methods {
+			if !router.ValidMethod(mtd) {
+				r.addError(configError(p, "Core.Methods", "Method %q is not a valid HTTP method", mtd))
+			} else if router.StandardMethod(mtd, true) {
+				r.addWarning(configError(p, "Core.Methods", "Method %s is not a custom method and is ignored", mtd))
+			}
+		}
+
+		if !c.Core.VirtualHosting && len(c.Core.VirtualHosts) > 0 {
+			r.addWarning(configError(p, "Core.VirtualHosts", "VirtualHosts are ignored because VirtualHosting is disabled"))
+		}
+		if !c.Core.VirtualHosting && c.Core.DefaultVhost != "" {
+			r.addWarning(configError(p, "Core.DefaultVhost", "DefaultVhost is ignored because VirtualHosting is disabled"))
+		}
+		if !c.Core.VirtualHosting && c.Core.UnknownHost != (UnknownHostConfig{}) {
+			r.addWarning(configError(p, "Core.UnknownHost", "UnknownHost is ignored because VirtualHosting is disabled"))
+		}
+		if len(c.Aliases) > 0 {
+			r.addWarning(configError(p, "Aliases", "Aliases are only used by vhosts"))
+		}
+	} else if !reflect.DeepEqual(c.Core, CoreConfig{}) {
+		r.addWarning(configError(p, "Core", "Core is ignored in a vhost configuration"))
+	}
+
+	for _, alias := range c.Aliases {
+		if alias == "" {
+			r.addError(configError(p, "Aliases", "Aliases cannot be empty"))
+		}
 	}
 
 	// Test virtual hosts
 	if !isVhost && c.Core.VirtualHosting {
 		if len(c.Core.VirtualHosts) == 0 {
-			log.Fatalf("%s: VirtualHosting is enabled but VirtualHosts is empty", p)
+			r.addError(configError(p, "Core.VirtualHosts", "VirtualHosting is enabled but VirtualHosts is empty"))
 		}
 		for k, v := range c.Core.VirtualHosts {
 			if v == "" {
-				log.Fatalf("%s: Virtual host configuration not defined. Check reference for %s", p, k)
+				r.addError(configError(p, "Core.VirtualHosts."+k, "Virtual host configuration not defined. Check reference for %s", k))
 			}
 		}
+
+		// Requests for unknown hosts are served by the default vhost, or answered as configured
+		if vhost := c.Core.DefaultVhost; vhost != "" {
+			if _, ok := c.Core.VirtualHosts[vhost]; !ok {
+				r.addError(configError(p, "Core.DefaultVhost", "DefaultVhost %s is not a vhost", vhost))
+			} else if router.IsHostPattern(vhost) {
+				r.addError(configError(p, "Core.DefaultVhost", "DefaultVhost %s cannot be a host pattern", vhost))
+			}
+			if c.Core.UnknownHost != (UnknownHostConfig{}) {
+				r.addWarning(configError(p, "Core.UnknownHost", "UnknownHost is ignored because DefaultVhost serves unknown hosts"))
+			}
+		}
+		c.Core.UnknownHost.validate(p, r)
+
+		// Serve and proxy are configured by the vhosts
 		return
 
-	} else if c.Core.VirtualHosting {
-		log.Fatalf("%s: Virtual hosting cannot be enabled in a vhost configuration", p)
+	} else if isVhost && c.Core.VirtualHosting {
+		r.addError(configError(p, "Core.VirtualHosting", "Virtual hosting cannot be enabled in a vhost configuration"))
+	}
+
+	// Test guard. Requests are always limited, so a rate or burst of zero blocks every request.
+	if c.Guard.Rate <= 0 || c.Guard.RateBurst <= 0 {
+		r.addWarning(configError(p, "Guard", "Rate and RateBurst must be higher than 0, or every request is rejected"))
+	}
+	if c.Guard.Clients < 0 {
+		r.addError(configError(p, "Guard.Clients", "Clients must be 0 or higher"))
 	}
 
-	// Test serve
-	if !c.Proxy.Enabled && c.Serve.Download.Enabled {
+	// Test serve. Both serving files and downloads use ServeDir and ServeIndex.
+	if !c.Proxy.Enabled {
 		if c.Serve.ServeDir == "" || c.Serve.ServeIndex == "" {
-			log.Fatalf("%s: The server configuration has missing elements: check ServeDir and ServeIndex", p)
+			r.addError(configError(p, "Serve", "The server configuration has missing elements: check ServeDir and ServeIndex"))
+		} else {
+
+			// We automatically fix ServeDir that doesn't end with a slash
+			if c.Serve.ServeDir[len(c.Serve.ServeDir)-1] != '/' {
+				c.Serve.ServeDir = c.Serve.ServeDir + "/"
+			}
+
+			if _, err := os.Stat(c.Serve.ServeDir); err != nil {
+				r.addWarning(&ConfigError{File: p, Field: "Serve.ServeDir", Err: err})
+			}
 		}
 
-		// We automatically fix ServeDir that doesn't end with a slash
-		if c.Serve.ServeDir[len(c.Serve.ServeDir)-1] != '/' {
-			c.Serve.ServeDir = c.Serve.ServeDir + "/"
+		if !c.Serve.Download.Enabled && len(c.Serve.Methods) == 0 {
+			r.addWarning(configError(p, "Serve.Methods", "No methods are defined, so nothing is served"))
 		}
 	}
 
 	// Test proxy
 	if c.Proxy.Enabled {
 		if len(c.Proxy.Rules) == 0 {
-			log.Fatalf("%s: Proxy is enabled but no rules are defined", p)
+			r.addError(configError(p, "Proxy.Rules", "Proxy is enabled but no rules are defined"))
+		}
+
+		for _, mtd := range c.Proxy.Methods {
+			if !router.ValidMethod(mtd) {
+				r.addError(configError(p, "Proxy.Methods", "Proxy method %q is not a valid HTTP method", mtd))
+			}
+		}
+
+		for rule, variants := range c.Proxy.Variants {
+			if _, ok := c.Proxy.Rules[rule]; !ok {
+				r.addError(configError(p, "Proxy.Variants."+rule, "Proxy variants are defined for %s, which has no proxy rule", rule))
+			}
+			for _, v := range variants {
+				if predicates, err := router.ParsePredicates(v.When); err != nil || len(predicates) == 0 || v.Target == "" {
+					r.addError(configError(p, "Proxy.Variants."+rule, "Proxy variant of %s needs valid predicates in When and a Target", rule))
+				}
+			}
+		}
+	}
+
+	// Test predicates
+	for path, predicates := range c.Serve.Predicates {
+		if _, ok := c.Serve.Methods[path]; !ok {
+			r.addError(configError(p, "Serve.Predicates."+path, "Predicates are defined for path %s, which has no methods", path))
+		}
+		if _, err := router.ParsePredicates(predicates); err != nil {
+			r.addError(&ConfigError{File: p, Field: "Serve.Predicates." + path, Err: err})
+		}
+	}
+
+	// Test methods. Methods of a vhost are checked against the custom methods of
+	// the main configuration by validateVhost.
+	for path, method := range c.Serve.Methods {
+		for _, mtd := range strings.Split(method, ";") {
+			if !router.ValidMethod(mtd) {
+				r.addError(configError(p, "Serve.Methods."+path, "Method %q of path %s is not a valid HTTP method", mtd, path))
+			}
+		}
+	}
+	if !isVhost {
+		c.checkMethods(p, c.Core, r)
+	}
+}
+
+// checkMethods adds an error to report r for each valid method of Serve.Methods and Proxy.Methods
+// of the configuration in file p that is not a default HTTP method, a WebDAV method if WebDAV is
+// enabled, or a custom method in core.Methods. Only these methods are registered in the router.
+func (c *Config) checkMethods(p string, core CoreConfig, r *Report) {
+
+	custom := make(map[string]bool, len(core.Methods))
+	for _, mtd := range core.Methods {
+		custom[mtd] = true
+	}
+	unknown := func(mtd string) bool {
+		return router.ValidMethod(mtd) && !router.StandardMethod(mtd, core.WebDAV) && !custom[mtd]
+	}
+
+	if c.Proxy.Enabled {
+		for _, mtd := range c.Proxy.Methods {
+			if unknown(mtd) {
+				r.addError(configError(p, "Proxy.Methods", "Proxy method %s is unknown, custom methods must be listed in Core.Methods", mtd))
+			}
+		}
+		return
+	}
+
+	for path, method := range c.Serve.Methods {
+		for _, mtd := range strings.Split(method, ";") {
+			if unknown(mtd) {
+				r.addError(configError(p, "Serve.Methods."+path, "Method %s of path %s is unknown, custom methods must be listed in Core.Methods", mtd, path))
+			}
 		}
 	}
 }
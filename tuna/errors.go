@@ -0,0 +1,70 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrServerStarted is returned by Server.Start if the server was started before
+	ErrServerStarted = errors.New("server already started")
+
+	// ErrServerNotStarted is returned by Server.Shutdown if the server was never started
+	ErrServerNotStarted = errors.New("server not started")
+
+	// ErrNoConfigFile is returned by Server.Reload if the server wasn't created from a config file
+	ErrNoConfigFile = errors.New("server has no config file to reload")
+)
+
+// ConfigError is the error returned when a configuration file cannot be loaded, is invalid,
+// or results in invalid routes. File is the configuration file, Field the key path of the
+// invalid field, for example Core.Port. Field is empty if the error concerns the complete file.
+// Line is the line of the field in the file, if it is known.
+type ConfigError struct {
+	File  string
+	Line  int
+	Field string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %v", e.File, e.Line, e.Field, e.Err)
+	}
+
+	switch {
+	case e.File == "" && e.Field == "":
+		return e.Err.Error()
+	case e.File == "":
+		return fmt.Sprintf("%s: %v", e.Field, e.Err)
+	case e.Field == "":
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	default:
+		return fmt.Sprintf("%s: %s: %v", e.File, e.Field, e.Err)
+	}
+}
+
+// Unwrap returns the underlying error
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configError returns a *ConfigError for field of file p, with a formatted message
+func configError(p, field, format string, a ...interface{}) *ConfigError {
+	return &ConfigError{File: p, Field: field, Err: fmt.Errorf(format, a...)}
+}
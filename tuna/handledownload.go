@@ -21,55 +21,60 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/redmaner/MaguroHTTP/debug"
 	"github.com/redmaner/MaguroHTTP/router"
 )
 
-// Function to handle HTTP requests to MaguroHTTP download server
-// This can be further configurated in the configuration file
-// MaguroHTTP download server generates a table of downloadable files based on extensions
-func (s *Server) handleDownload() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// downloadListTTL is the time the list of downloadable files of a ServeDir is cached
+const downloadListTTL = 10 * time.Second
 
-		host := router.StripHostPort(r.Host)
+// downloadFiles returns the files in dir, and its sub directories, with an extension in exts
+func downloadFiles(dir string, exts []string) ([]fileInfo, error) {
 
-		var dlurls []fileInfo
+	var dlurls []fileInfo
+	for _, v := range exts {
+		err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
 
-		cfg := s.Cfg
+			// f is nil if dir can't be read, and the walk has to stop
+			if err != nil {
+				return err
+			}
 
-		// If virtual hosting is enabled, the configuration is switched to the
-		// configuration of the vhost
-		if cfg.Core.VirtualHosting {
-			if _, ok := cfg.Core.VirtualHosts[host]; ok {
-				cfg = s.Vhosts[host]
+			if f.IsDir() {
+				return nil
 			}
-		}
 
-		// Collect downloadable files
-		if cfg.Serve.Download.Enabled {
-			for _, v := range cfg.Serve.Download.Exts {
-				err := filepath.Walk(cfg.Serve.ServeDir, func(path string, f os.FileInfo, _ error) error {
-					if f.IsDir() {
-						return nil
-					}
-
-					if filepath.Ext(f.Name()) != v {
-						return nil
-					}
-
-					dlurls = append(dlurls, fileInfo{
-						Name:    f.Name(),
-						Size:    f.Size(),
-						ModTime: f.ModTime(),
-					})
-					return nil
-				})
-				if err != nil {
-					s.HandleError(w, r, 500)
-					return
-				}
+			if filepath.Ext(f.Name()) != v {
+				return nil
 			}
+
+			dlurls = append(dlurls, fileInfo{
+				Name:    f.Name(),
+				Size:    f.Size(),
+				ModTime: f.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	return dlurls, nil
+}
+
+// Function to handle HTTP requests to MaguroHTTP download server
+// This can be further configurated in the configuration file
+// MaguroHTTP download server generates a table of downloadable files based on extensions
+func (s *Server) handleDownload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		host := router.StripHostPort(r.Host)
+
+		cfg := s.hostConfig(host)
 
 		path := r.URL.Path
 
@@ -82,6 +87,20 @@ func (s *Server) handleDownload() http.HandlerFunc {
 
 		// If the request path is ServeIndex, generate the index page with downloadable files
 		if path == cfg.Serve.ServeIndex {
+
+			// Collect downloadable files. The list is cached for a short time, and concurrent
+			// requests wait for a single walk of ServeDir.
+			key := cfg.Serve.ServeDir + "|" + strings.Join(cfg.Serve.Download.Exts, "|")
+			files, err := s.downloads.GetOrLoad(key, downloadListTTL, func() (interface{}, error) {
+				return downloadFiles(cfg.Serve.ServeDir, cfg.Serve.Download.Exts)
+			})
+			if err != nil {
+				s.Log(debug.LogError, err)
+				s.HandleError(w, r, 500)
+				return
+			}
+			dlurls := files.([]fileInfo)
+
 			w.Header().Set("Content-Type", "text/html")
 			s.setHeaders(w, cfg.Serve.Headers, false)
 			s.WriteString(buf, "<h1>Downloads</h1>")
@@ -98,7 +117,7 @@ func (s *Server) handleDownload() http.HandlerFunc {
 				DownloadTable: template.HTML(buf.String()),
 			}
 
-			if err := s.templates.download.Execute(w, data); err != nil {
+			if err := s.currentTemplates().download.Execute(w, data); err != nil {
 				s.HandleError(w, r, 500)
 				return
 			}
@@ -0,0 +1,54 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tuna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.zip", "b.txt", "sub/c.zip"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := downloadFiles(dir, []string{".zip"})
+	if err != nil {
+		t.Fatalf("Listing %s failed: %v", dir, err)
+	}
+	if len(files) != 2 || files[0].Name != "a.zip" || files[1].Name != "c.zip" {
+		t.Errorf("Expected a.zip and c.zip, got %v", files)
+	}
+
+	// A missing ServeDir is an error, instead of a panic in the walk
+	if _, err := downloadFiles(filepath.Join(dir, "missing"), []string{".zip"}); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error for a missing directory, got %v", err)
+	}
+}
@@ -33,15 +33,7 @@ func (s *Server) HandleError(w http.ResponseWriter, r *http.Request, errorCode i
 	s.setHeaders(w, map[string]string{}, false)
 
 	host := router.StripHostPort(r.Host)
-	cfg := s.Cfg
-
-	// If virtual hosting is enabled, the configuration is switched to the
-	// configuration of the vhost
-	if cfg.Core.VirtualHosting {
-		if _, ok := cfg.Core.VirtualHosts[host]; ok {
-			cfg = s.Vhosts[host]
-		}
-	}
+	cfg := s.hostConfig(host)
 
 	// Custom error pages can be set in the configuration.
 	if val, ok := cfg.Errors[strconv.Itoa(errorCode)]; ok {
@@ -66,6 +58,8 @@ func (s *Server) HandleError(w http.ResponseWriter, r *http.Request, errorCode i
 		s.WriteString(buf, "<h3>Error 405 - Method not allowed</h3>")
 	case 406:
 		s.WriteString(buf, "<h3>Error 406 - Unacceptable</h3>")
+	case 421:
+		s.WriteString(buf, "<h3>Error 421 - Misdirected request</h3>")
 	case 429:
 		s.WriteString(buf, "<h3>Error 429 - Too many requests</h3>")
 	case 502:
@@ -80,7 +74,7 @@ func (s *Server) HandleError(w http.ResponseWriter, r *http.Request, errorCode i
 		HTTPError: template.HTML(buf.String()),
 	}
 
-	if err := s.templates.error.Execute(w, data); err != nil {
+	if err := s.currentTemplates().error.Execute(w, data); err != nil {
 		s.Log(debug.LogError, err)
 	}
 }
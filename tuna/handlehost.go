@@ -0,0 +1,69 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/redmaner/MaguroHTTP/router"
+)
+
+// ServeHTTP dispatches requests to the router of the server. If virtual hosting is enabled,
+// requests for aliases and for hosts served by the default vhost are routed as the host of
+// their vhost, with router.WithRouteHost, so handlers still see the Host the client sent. Requests for hosts no vhost serves are answered as configured by Core.UnknownHost,
+// except for the metrics page.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	host := router.StripHostPort(r.Host)
+
+	s.cfgMu.RLock()
+	vhost, ok := s.vhost(host)
+	metrics := s.Cfg.Core.Metrics
+	s.cfgMu.RUnlock()
+
+	switch {
+	case !ok && !(metrics.Enabled && r.URL.Path == metrics.Path):
+		s.handleUnknownHost(w, r)
+		return
+
+	// Requests matching a host pattern vhost are routed with their own host
+	case ok && vhost != host && !router.IsHostPattern(vhost):
+		r = router.WithRouteHost(r, vhost)
+	}
+
+	s.Router.ServeHTTP(w, r)
+}
+
+// handleUnknownHost answers requests for hosts that are not served by a vhost
+func (s *Server) handleUnknownHost(w http.ResponseWriter, r *http.Request) {
+
+	cfg, _ := s.config()
+	unknown := cfg.Core.UnknownHost
+
+	if unknown.Redirect == "" {
+		if unknown.Status == 0 {
+			unknown.Status = 404
+		}
+		s.HandleError(w, r, unknown.Status)
+		return
+	}
+
+	if unknown.Status == 0 {
+		unknown.Status = 302
+	}
+	http.Redirect(w, r, strings.TrimSuffix(unknown.Redirect, "/")+r.URL.RequestURI(), unknown.Status)
+	s.LogNetwork(unknown.Status, r)
+}
@@ -26,74 +26,75 @@ import (
 
 // Function to proxy. The proxy can be configurated in configuration
 // MaguroHTTP is capable to serve HTTP and to proxy along side each other using virtual hosts
-func (s *Server) handleProxy() http.HandlerFunc {
+// Requests are proxied to target, or to the target of the proxy rule of the host if target is empty.
+func (s *Server) handleProxy(target string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		host := router.StripHostPort(r.Host)
 
-		cfg := s.Cfg
+		cfg := s.hostConfig(host)
 
-		// If virtual hosting is enabled, the configuration is switched to the
-		// configuration of the vhost
-		if cfg.Core.VirtualHosting {
-			if _, ok := cfg.Core.VirtualHosts[host]; ok {
-				cfg = s.Vhosts[host]
+		// Without target, the target is the proxy rule matching the host the request is routed as,
+		// which is the host of the vhost for aliases
+		val := target
+		if val == "" {
+			rule, ok := matchHost(cfg.Proxy.Rules, router.RouteHost(r))
+			if !ok {
+				return
 			}
+			val = cfg.Proxy.Rules[rule]
 		}
 
-		if val, ok := cfg.Proxy.Rules[host]; ok {
-
-			// The http.NewRequest function completely zero's out an existing request body
-			// when passed in as an argument. Therefore the request body is first unwrapped
-			// in a slice of bytes, and then passed in with a bytes.Buffer wrapper.
-			bodyData, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				s.Log(debug.LogError, err)
-				s.HandleError(w, r, 502)
-				return
-			}
+		// The http.NewRequest function completely zero's out an existing request body
+		// when passed in as an argument. Therefore the request body is first unwrapped
+		// in a slice of bytes, and then passed in with a bytes.Buffer wrapper.
+		bodyData, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s.Log(debug.LogError, err)
+			s.HandleError(w, r, 502)
+			return
+		}
 
-			// We compose a new request with the desired proxy host, the original request method
-			// and original request body.
-			req, err := http.NewRequest(r.Method, val+r.RequestURI, bytes.NewBuffer(bodyData))
-			if err != nil {
-				s.Log(debug.LogError, err)
-				s.HandleError(w, r, 502)
-				return
-			}
+		// We compose a new request with the desired proxy host, the original request method
+		// and original request body.
+		req, err := http.NewRequest(r.Method, val+r.RequestURI, bytes.NewBuffer(bodyData))
+		if err != nil {
+			s.Log(debug.LogError, err)
+			s.HandleError(w, r, 502)
+			return
+		}
 
-			req.Host = host
+		req.Host = host
 
-			// We clone the header of the original request
-			req.Header = cloneHeader(r.Header)
+		// We clone the header of the original request
+		req.Header = cloneHeader(r.Header)
 
-			// For proxy purposes we keep the original remote address in the request
-			req.RemoteAddr = r.RemoteAddr
+		// For proxy purposes we keep the original remote address in the request
+		req.RemoteAddr = r.RemoteAddr
 
-			// the new request is executed with a http.RoundTripper.
-			if resp, err := s.Transport.RoundTrip(req); err == nil {
+		// the new request is executed with a http.RoundTripper.
+		if resp, err := s.Transport.RoundTrip(req); err == nil {
 
-				// Proxy back all response headers
-				copyHeader(w.Header(), resp.Header)
+			// Proxy back all response headers
+			copyHeader(w.Header(), resp.Header)
 
-				// Set custom headers
-				s.setHeaders(w, cfg.Proxy.Headers, true)
+			// Set custom headers
+			s.setHeaders(w, cfg.Proxy.Headers, true)
 
-				// Write header last. If header is written, headers can no longer be set
-				w.WriteHeader(resp.StatusCode)
+			// Write header last. If header is written, headers can no longer be set
+			w.WriteHeader(resp.StatusCode)
 
-				// Copy back the response body to the ResponseWriter
-				_, err = io.Copy(w, resp.Body)
-				s.Log(debug.LogError, err)
+			// Copy back the response body to the ResponseWriter
+			_, err = io.Copy(w, resp.Body)
+			s.Log(debug.LogError, err)
 
-				// Properly close response body
-				err = resp.Body.Close()
-				s.Log(debug.LogError, err)
-				s.LogNetwork(resp.StatusCode, r)
-			} else {
-				s.Log(debug.LogError, err)
-				s.HandleError(w, r, 502)
-			}
+			// Properly close response body
+			err = resp.Body.Close()
+			s.Log(debug.LogError, err)
+			s.LogNetwork(resp.StatusCode, r)
+		} else {
+			s.Log(debug.LogError, err)
+			s.HandleError(w, r, 502)
 		}
 	}
 }
@@ -28,15 +28,7 @@ func (s *Server) handleServe() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		host := router.StripHostPort(r.Host)
-		cfg := s.Cfg
-
-		// If virtual hosting is enabled, the configuration is switched to the
-		// configuration of the vhost
-		if cfg.Core.VirtualHosting {
-			if _, ok := cfg.Core.VirtualHosts[host]; ok {
-				cfg = s.Vhosts[host]
-			}
-		}
+		cfg := s.hostConfig(host)
 
 		path := r.URL.Path
 
@@ -0,0 +1,420 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// Configuration files support three additions to HCL and JSON, which are resolved when a file is loaded:
+//
+//	Include = ["vhosts.d/*.hcl"]        includes the files matching the patterns, at the top level of a file
+//	Port = "${PORT:-8080}"               the environment variable PORT, or 8080 if PORT is unset or empty
+//	Password = "${file(\"/run/secret\")}" the contents of a file, without trailing newlines
+//
+// Paths are relative to the directory of the file they are used in. Included files are loaded before
+// the file including them, so the settings of the including file take precedence, while maps and
+// blocks are merged. A literal ${ is written as $${.
+
+// includeKey is the key of the include directive
+const includeKey = "Include"
+
+// envName matches the names of environment variables that can be interpolated
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// configLoader loads configuration files, resolving includes, environment variables and secret files
+type configLoader struct {
+
+	// visit is called with each file after its environment variables and secret files are
+	// resolved, and before it is merged with the files it includes
+	visit func(p string, list *ast.ObjectList)
+
+	// errs holds the problems found while loading
+	errs []*ConfigError
+
+	// files holds every file and directory the configuration was loaded from, including
+	// secret files and the directories of include patterns, so they can be watched for changes
+	files []string
+
+	// loading holds the files that are being loaded, to detect include cycles
+	loading map[string]bool
+
+	// vhosts holds the vhosts declared inline, by host
+	vhosts map[string]inlineVhost
+}
+
+// loadConfigFile loads configuration file p to c. It returns the vhosts declared inline by host,
+// and the files the configuration was loaded from.
+func loadConfigFile(p string, c *Config) (map[string]inlineVhost, []string, error) {
+
+	ld := configLoader{}
+	list := ld.load(p)
+	if len(ld.errs) > 0 {
+		return nil, ld.files, ld.errs[0]
+	}
+
+	if err := hcl.DecodeObject(c, list); err != nil {
+		return nil, ld.files, &ConfigError{File: p, Err: err}
+	}
+
+	return ld.vhosts, ld.files, nil
+}
+
+// load parses file p and the files it includes, and returns the merged items
+func (ld *configLoader) load(p string) *ast.ObjectList {
+
+	if ld.loading == nil {
+		ld.loading = make(map[string]bool)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		abs = p
+	}
+	if ld.loading[abs] {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Err: errors.New("include cycle, the file is already being loaded")})
+		return &ast.ObjectList{}
+	}
+	ld.loading[abs] = true
+	defer delete(ld.loading, abs)
+
+	ld.files = append(ld.files, p)
+
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Err: err})
+		return &ast.ObjectList{}
+	}
+
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Err: err})
+		return &ast.ObjectList{}
+	}
+
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Err: errors.New("configuration is not a list of keys and blocks")})
+		return &ast.ObjectList{}
+	}
+
+	dir := filepath.Dir(p)
+	ld.interpolate(p, dir, "", list)
+
+	// Separate the include directives and vhost blocks from the settings
+	var patterns []string
+	settings := make([]*ast.ObjectItem, 0, len(list.Items))
+	for _, item := range list.Items {
+		switch key := item.Keys[0].Token.Value().(string); {
+		case len(item.Keys) == 1 && strings.EqualFold(key, includeKey):
+			patterns = append(patterns, ld.includePatterns(p, item)...)
+		case strings.EqualFold(key, vhostKey):
+			ld.addVhosts(p, item)
+		default:
+			settings = append(settings, item)
+		}
+	}
+	list.Items = settings
+
+	if ld.visit != nil {
+		ld.visit(p, list)
+	}
+
+	// Included files come first, so the settings of this file take precedence
+	merged := &ast.ObjectList{}
+	for _, pattern := range patterns {
+		for _, include := range ld.glob(p, dir, pattern) {
+			merged.Items = append(merged.Items, ld.load(include).Items...)
+		}
+	}
+	merged.Items = append(merged.Items, list.Items...)
+
+	return merged
+}
+
+// addVhosts adds the vhosts declared by vhost block item of file p. Blocks are written as
+// Vhost "example.com" { ... } in HCL, and as "Vhost": {"example.com": { ... }} in JSON.
+// Blocks of the same host are merged.
+func (ld *configLoader) addVhosts(p string, item *ast.ObjectItem) {
+
+	var hosts []*ast.ObjectItem
+	if len(item.Keys) > 1 {
+		hosts = []*ast.ObjectItem{{Keys: item.Keys[1:], Val: item.Val}}
+	} else if items, ok := objectItems(item.Val); ok {
+		hosts = items
+	}
+
+	if len(hosts) == 0 {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Line: item.Pos().Line, Field: vhostKey,
+			Err: errors.New("Vhost blocks must be written as Vhost \"host\" { ... }")})
+		return
+	}
+
+	if ld.vhosts == nil {
+		ld.vhosts = make(map[string]inlineVhost)
+	}
+
+	for _, host := range hosts {
+		name := host.Keys[0].Token.Value().(string)
+		items, ok := objectItems(itemValue(host))
+		if !ok {
+			ld.errs = append(ld.errs, &ConfigError{File: p, Line: host.Pos().Line, Field: vhostKey + "." + name,
+				Err: errors.New("Vhost must be a block")})
+			continue
+		}
+
+		vhost, ok := ld.vhosts[name]
+		if !ok {
+			vhost = inlineVhost{file: p, list: &ast.ObjectList{}}
+		}
+		vhost.list.Items = append(vhost.list.Items, items...)
+		ld.vhosts[name] = vhost
+	}
+}
+
+// includePatterns returns the patterns of include directive item
+func (ld *configLoader) includePatterns(p string, item *ast.ObjectItem) []string {
+
+	var nodes []ast.Node
+	if list, ok := item.Val.(*ast.ListType); ok {
+		nodes = list.List
+	} else {
+		nodes = []ast.Node{item.Val}
+	}
+
+	patterns := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if lit, ok := node.(*ast.LiteralType); ok && lit.Token.Type == token.STRING {
+			patterns = append(patterns, lit.Token.Value().(string))
+			continue
+		}
+		ld.errs = append(ld.errs, &ConfigError{File: p, Line: node.Pos().Line, Field: includeKey,
+			Err: errors.New("Include must be a string or a list of strings")})
+	}
+
+	return patterns
+}
+
+// glob returns the files matching include pattern, relative to dir. A pattern without wildcards
+// must match a file, a pattern with wildcards may match nothing.
+func (ld *configLoader) glob(p, dir, pattern string) []string {
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Field: includeKey, Err: fmt.Errorf("%s: %v", pattern, err)})
+		return nil
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if len(matches) == 0 {
+			ld.errs = append(ld.errs, &ConfigError{File: p, Field: includeKey, Err: fmt.Errorf("%s: no such file", pattern)})
+		}
+		return matches
+	}
+
+	// Watch the directory of the pattern, so added and removed files are noticed
+	ld.files = append(ld.files, filepath.Dir(pattern))
+	sort.Strings(matches)
+	return matches
+}
+
+// interpolate resolves environment variables and secret files in the strings and keys of node,
+// found at key path field of file p
+func (ld *configLoader) interpolate(p, dir, field string, node ast.Node) {
+
+	switch n := node.(type) {
+	case *ast.ObjectList:
+		for _, item := range n.Items {
+			itemField := field
+			for _, key := range item.Keys {
+				if key.Token.Type == token.STRING {
+					key.Token = ld.expandToken(p, dir, itemField, key.Token, false)
+				}
+				itemField = joinField(itemField, key.Token.Value().(string))
+			}
+			ld.interpolate(p, dir, itemField, item.Val)
+		}
+
+	case *ast.ObjectType:
+		ld.interpolate(p, dir, field, n.List)
+
+	case *ast.ListType:
+		for i, elem := range n.List {
+			ld.interpolate(p, dir, fmt.Sprintf("%s[%d]", field, i), elem)
+		}
+
+	case *ast.LiteralType:
+		if n.Token.Type == token.STRING || n.Token.Type == token.HEREDOC {
+			n.Token = ld.expandToken(p, dir, field, n.Token, n.Token.Type == token.STRING)
+		}
+	}
+}
+
+// expandToken returns string token t with its interpolations resolved. If typed is true and t is
+// a single interpolation, like "${RATE:-100}", whose value is a bool, number or float, the token of
+// that type is returned, so the value can be decoded into a bool, int or float field.
+func (ld *configLoader) expandToken(p, dir, field string, t token.Token, typed bool) token.Token {
+
+	value := t.Value().(string)
+	if !strings.Contains(value, "${") {
+		return t
+	}
+
+	expanded, err := ld.expand(dir, value)
+	if err != nil {
+		ld.errs = append(ld.errs, &ConfigError{File: p, Line: t.Pos.Line, Field: field, Err: err})
+		return t
+	}
+
+	if typed && strings.HasPrefix(value, "${") && closingBrace(value[2:]) == len(value)-3 {
+		if typ := literalType(expanded); typ != token.STRING {
+			return token.Token{Type: typ, Pos: t.Pos, Text: expanded}
+		}
+	}
+
+	// JSON tokens are unquoted with strconv.Unquote, so the expanded value is kept exactly
+	return token.Token{Type: token.STRING, Pos: t.Pos, Text: strconv.Quote(expanded), JSON: true}
+}
+
+// literalType returns the type of the HCL literal s is written as, which is token.BOOL for true
+// and false, token.NUMBER for integers and token.FLOAT for decimals. Any other value is a string.
+func literalType(s string) token.Type {
+
+	switch {
+	case s == "true" || s == "false":
+		return token.BOOL
+	case s == "" || strings.Trim(s, "+-0123456789.eE") != "" || !strings.ContainsAny(s, "0123456789"):
+		return token.STRING
+	}
+
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return token.NUMBER
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return token.FLOAT
+	}
+	return token.STRING
+}
+
+// expand resolves the interpolations ${NAME}, ${NAME:-default} and ${file("path")} in s
+func (ld *configLoader) expand(dir, s string) (string, error) {
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		// $${ is a literal ${
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		b.WriteString(s[:i])
+		end := closingBrace(s[i+2:])
+		if end < 0 {
+			return "", fmt.Errorf("interpolation %q is not closed", s[i:])
+		}
+
+		value, err := ld.resolve(dir, strings.TrimSpace(s[i+2:i+2+end]))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		s = s[i+3+end:]
+	}
+}
+
+// closingBrace returns the index of the brace closing an interpolation in s,
+// skipping braces in quoted strings, or -1 if the interpolation isn't closed
+func closingBrace(s string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == '}' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// resolve returns the value of interpolation expression expr
+func (ld *configLoader) resolve(dir, expr string) (string, error) {
+
+	// Secret files
+	if strings.HasPrefix(expr, "file(") && strings.HasSuffix(expr, ")") {
+		name, err := strconv.Unquote(strings.TrimSpace(expr[len("file(") : len(expr)-1]))
+		if err != nil {
+			return "", fmt.Errorf("file in %q needs a quoted path", expr)
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+
+		ld.files = append(ld.files, name)
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	// Environment variables, with an optional default
+	name, def := expr, ""
+	hasDefault := false
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		name, def, hasDefault = expr[:i], expr[i+2:], true
+	}
+
+	if !envName.MatchString(name) {
+		return "", fmt.Errorf("invalid interpolation %q, expected ${NAME}, ${NAME:-default} or ${file(\"path\")}", expr)
+	}
+
+	value, ok := os.LookupEnv(name)
+	switch {
+	case ok && value != "":
+		return value, nil
+	case hasDefault:
+		return def, nil
+	case ok:
+		return "", nil
+	}
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
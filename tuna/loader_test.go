@@ -0,0 +1,110 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFileTypedInterpolation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tuna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("TUNA_TEST_WEBDAV", "true")
+	os.Setenv("TUNA_TEST_PORT", "8443")
+	defer os.Unsetenv("TUNA_TEST_WEBDAV")
+	defer os.Unsetenv("TUNA_TEST_PORT")
+
+	p := filepath.Join(dir, "main.hcl")
+	config := `Core {
+  Port = "${TUNA_TEST_PORT}"
+  WebDAV = "${TUNA_TEST_WEBDAV}"
+  VirtualHosting = "${TUNA_TEST_VHOSTS:-false}"
+  ReloadInterval = "${TUNA_TEST_RELOAD:-30}"
+  LogOut = "${TUNA_TEST_LOG:-stdout}"
+}
+Guard {
+  Rate = "${TUNA_TEST_RATE:-2.5}"
+  RateBurst = "${TUNA_TEST_BURST:-10}"
+  FilterOnIP = "${TUNA_TEST_FILTER:-true}"
+}`
+	if err := ioutil.WriteFile(p, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Config
+	if _, _, err := loadConfigFile(p, &c); err != nil {
+		t.Fatalf("Loading %s failed: %v", p, err)
+	}
+
+	if c.Core.Port != "8443" {
+		t.Errorf("Core.Port should be 8443, got %q", c.Core.Port)
+	}
+	if !c.Core.WebDAV {
+		t.Error("Core.WebDAV should be true")
+	}
+	if c.Core.VirtualHosting {
+		t.Error("Core.VirtualHosting should be false")
+	}
+	if c.Core.ReloadInterval != 30 {
+		t.Errorf("Core.ReloadInterval should be 30, got %d", c.Core.ReloadInterval)
+	}
+	if c.Core.LogOut != "stdout" {
+		t.Errorf("Core.LogOut should be stdout, got %q", c.Core.LogOut)
+	}
+	if c.Guard.Rate != 2.5 {
+		t.Errorf("Guard.Rate should be 2.5, got %v", c.Guard.Rate)
+	}
+	if c.Guard.RateBurst != 10 {
+		t.Errorf("Guard.RateBurst should be 10, got %d", c.Guard.RateBurst)
+	}
+	if !c.Guard.FilterOnIP {
+		t.Error("Guard.FilterOnIP should be true")
+	}
+}
+
+func TestLiteralType(t *testing.T) {
+
+	tests := []struct {
+		value string
+		typ   string
+	}{
+		{"true", "BOOL"},
+		{"false", "BOOL"},
+		{"100", "NUMBER"},
+		{"-1", "NUMBER"},
+		{"2.5", "FLOAT"},
+		{"1e3", "FLOAT"},
+		{"", "STRING"},
+		{"yes", "STRING"},
+		{"1.2.3", "STRING"},
+		{"Inf", "STRING"},
+		{"e", "STRING"},
+		{"8080/tcp", "STRING"},
+	}
+
+	for _, tt := range tests {
+		if typ := literalType(tt.value).String(); typ != tt.typ {
+			t.Errorf("%q should be a %s, got %s", tt.value, tt.typ, typ)
+		}
+	}
+}
@@ -17,13 +17,16 @@ package tuna
 import (
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/redmaner/MaguroHTTP/debug"
+	"github.com/redmaner/MaguroHTTP/guard"
 	"github.com/redmaner/MaguroHTTP/html"
 )
 
@@ -36,6 +39,12 @@ type metricsData struct {
 	Paths         map[int]map[string]int
 }
 
+// metricsFile holds the metrics data that is saved to Metrics.Out
+type metricsFile struct {
+	TotalRequests int
+	Paths         map[int]map[string]int
+}
+
 // Concat function to increase metrics
 // MaguroHTTP only logs aggregated metrics, without storing any sensitive information
 // MaguroHTTP Metrics stores:
@@ -63,6 +72,7 @@ func (md *metricsData) concat(e int, p string) {
 // Function to display metrics data
 func (md *metricsData) display(o io.Writer) error {
 	md.mu.Lock()
+	defer md.mu.Unlock()
 
 	if _, err := io.WriteString(o, fmt.Sprintf("<h1>MaguroHTTP metrics</h1><br><b>Total requests:</b> %d<br>", md.TotalRequests)); err != nil {
 		return err
@@ -80,10 +90,40 @@ func (md *metricsData) display(o io.Writer) error {
 			return err
 		}
 	}
-	md.mu.Unlock()
 	return nil
 }
 
+// displayLimiters displays the statistics of the caches of the limiters, in which the
+// limiters remember clients
+func displayLimiters(o io.Writer, limiters map[string]*guard.Limiter) error {
+
+	hosts := make([]string, 0, len(limiters))
+	for host := range limiters {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	if _, err := io.WriteString(o, "<br><b>Limiters</b><ul>"); err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		st := limiters[host].Stats()
+
+		// The average distance of a client in the cache, to tell whether the cache is large enough
+		var distance float64
+		if st.Hits > 0 {
+			distance = float64(st.Scanned) / float64(st.Hits)
+		}
+
+		if _, err := io.WriteString(o, fmt.Sprintf("<li>Host: %s - Hits: %d - Misses: %d - Average distance: %.1f - Overwritten: %d - Expired: %d</li>",
+			template.HTMLEscapeString(host), st.Hits, st.Misses, distance, st.Overwritten, st.Expired)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(o, "</ul>")
+	return err
+}
+
 func (s *Server) handleMetrics() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -93,15 +133,21 @@ func (s *Server) handleMetrics() http.HandlerFunc {
 		if err := s.metrics.display(w); err != nil {
 			s.Log(debug.LogError, err)
 		}
+		s.cfgMu.RLock()
+		limiters := s.limiters
+		s.cfgMu.RUnlock()
+		if err := displayLimiters(w, limiters); err != nil {
+			s.Log(debug.LogError, err)
+		}
 		s.WriteString(w, html.PageTemplateEnd)
 		s.LogNetwork(200, r)
 	}
 }
 
-// Metrics Daemon
-func (s *Server) metricsDaemon() {
+// loadMetrics initially loads metrics if they are present. It is called by Start
+// before the server accepts requests.
+func (s *Server) loadMetrics() {
 
-	// Initially load metrics if they are present
 	if !s.Cfg.Core.Metrics.Enabled || !s.Cfg.Core.TLS.Enabled {
 		s.metrics = metricsData{
 			enabled: false,
@@ -118,34 +164,44 @@ func (s *Server) metricsDaemon() {
 		return
 	}
 
-	// Load metrics from the file
+	// Load metrics from the file. If they cannot be loaded, metrics start empty
+	// instead of stopping the server.
+	var md metricsFile
 	file, err := os.Open(s.Cfg.Core.Metrics.Out)
-	if err != nil {
-		s.Log(debug.LogError, err)
-		os.Exit(1)
-	}
+	if err == nil {
 
-	var md metricsData
-
-	// Metrics are saved in json and are decoded to a metricsData struct
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&md)
+		// Metrics are saved in json and are decoded to a metricsData struct
+		decoder := json.NewDecoder(file)
+		err = decoder.Decode(&md)
+		s.Log(debug.LogError, file.Close())
+	}
 	if err != nil {
 		s.Log(debug.LogError, err)
-		os.Exit(1)
+		md.Paths = make(map[int]map[string]int)
 	}
 
 	s.metrics.TotalRequests = md.TotalRequests
 	s.metrics.Paths = md.Paths
 	s.metrics.enabled = s.Cfg.Core.Metrics.Enabled
+}
 
-	err = file.Close()
-	s.Log(debug.LogError, err)
+// Metrics Daemon
+func (s *Server) metricsDaemon() {
 
-	// Occasionally flush metrics to disk
+	if !s.metrics.enabled {
+		return
+	}
+
+	// Occasionally flush metrics to disk, until the server is stopped
+	ticker := time.NewTicker(20 * time.Minute)
+	defer ticker.Stop()
 	for {
-		time.Sleep(20 * time.Minute)
-		s.flushMetrics()
+		select {
+		case <-ticker.C:
+			s.flushMetrics()
+		case <-s.stop:
+			return
+		}
 	}
 }
 
@@ -154,14 +210,18 @@ func (s *Server) flushMetrics() {
 	var mdout *os.File
 	var err error
 
-	mdout, err = os.Create(s.Cfg.Core.Metrics.Out)
+	cfg, _ := s.config()
+	mdout, err = os.Create(cfg.Core.Metrics.Out)
 	s.Log(debug.LogError, err)
 
-	mdout, err = os.OpenFile(s.Cfg.Core.Metrics.Out, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	mdout, err = os.OpenFile(cfg.Core.Metrics.Out, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	s.Log(debug.LogError, err)
 
 	s.metrics.mu.Lock()
-	bs, err := json.MarshalIndent(s.metrics, "", "  ")
+	bs, err := json.MarshalIndent(metricsFile{
+		TotalRequests: s.metrics.TotalRequests,
+		Paths:         s.metrics.Paths,
+	}, "", "  ")
 	s.Log(debug.LogError, err)
 	s.metrics.mu.Unlock()
 
@@ -0,0 +1,81 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/redmaner/MaguroHTTP/debug"
+)
+
+// Option configures a Server created with New
+type Option func(*Server)
+
+// WithConfigFile loads the configuration of the server, and the configurations of its vhosts,
+// from the config file p. It takes precedence over WithConfig.
+func WithConfigFile(p string) Option {
+	return func(s *Server) {
+		s.configFile = p
+	}
+}
+
+// WithConfig sets the configuration of the server. The configurations of the vhosts
+// are loaded from the files defined in c.Core.VirtualHosts.
+func WithConfig(c Config) Option {
+	return func(s *Server) {
+		s.Cfg = c
+	}
+}
+
+// WithListener makes the server accept connections on l, instead of listening on the
+// address and port of the configuration. This can be used to serve on a random port.
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// WithSignals makes the server shutdown gracefully when one of the signals is received.
+// By default the server doesn't handle any signals.
+func WithSignals(signals ...os.Signal) Option {
+	return func(s *Server) {
+		s.signals = signals
+	}
+}
+
+// WithReloadSignals makes the server reload its configuration when one of the signals
+// is received, see Server.Reload. By default the server doesn't handle any signals.
+func WithReloadSignals(signals ...os.Signal) Option {
+	return func(s *Server) {
+		s.reloadSignals = signals
+	}
+}
+
+// WithLogger sets the logger of the server, instead of the logger defined by
+// LogLevel and LogOut of the configuration
+func WithLogger(l *debug.Logger) Option {
+	return func(s *Server) {
+		s.logInterface = l
+	}
+}
+
+// WithTransport sets the transport used to proxy requests
+func WithTransport(t http.RoundTripper) Option {
+	return func(s *Server) {
+		s.Transport = t
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/redmaner/MaguroHTTP/debug"
+	"github.com/redmaner/MaguroHTTP/router"
+)
+
+// config returns the configuration of the server and the configurations of the vhosts.
+// They are replaced when the configuration is reloaded, so while the server is serving
+// they must be read with config instead of Cfg and Vhosts.
+func (s *Server) config() (Config, map[string]Config) {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.Cfg, s.Vhosts
+}
+
+// hostConfig returns the configuration used for host. If virtual hosting is enabled,
+// this is the configuration of the vhost serving host, see vhost.
+func (s *Server) hostConfig(host string) Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+
+	if vhost, ok := s.vhost(host); ok && s.Cfg.Core.VirtualHosting {
+		return s.Vhosts[vhost]
+	}
+	return s.Cfg
+}
+
+// vhost returns the vhost serving host: the vhost matching host or an alias of the vhost,
+// or else the default vhost. It reports false if no vhost serves host. If virtual hosting
+// is disabled, host itself is returned. s.cfgMu must be held.
+func (s *Server) vhost(host string) (string, bool) {
+
+	if !s.Cfg.Core.VirtualHosting {
+		return host, true
+	}
+	if match, ok := matchHost(s.hosts, host); ok {
+		return s.hosts[match], true
+	}
+	if s.Cfg.Core.DefaultVhost != "" {
+		return s.Cfg.Core.DefaultVhost, true
+	}
+	return "", false
+}
+
+// currentTemplates returns the templates of the server, which are replaced when the
+// configuration is reloaded
+func (s *Server) currentTemplates() templates {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.templates
+}
+
+// Reload re-reads and validates the configuration file and the configurations of the vhosts.
+// Templates, limiters, firewalls and routes are rebuilt and swapped in together with the new
+// configuration, while requests in flight finish with the old ones. If the new configuration
+// is invalid, the current configuration is kept and the error is returned. Changes to settings
+// that are used when the server starts, like the port and TLS, are logged and take effect after
+// a restart. Every reload attempt is logged.
+func (s *Server) Reload() error {
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if err := s.reload(); err != nil {
+		s.Log(debug.LogNone, fmt.Errorf("Reloading configuration failed, keeping the current configuration: %v", err))
+		return err
+	}
+
+	s.Log(debug.LogNone, fmt.Errorf("Reloaded configuration %s", s.configFile))
+	return nil
+}
+
+func (s *Server) reload() error {
+
+	if s.configFile == "" {
+		return ErrNoConfigFile
+	}
+
+	cfg, vhosts, files, err := loadConfig(s.configFile)
+	if err != nil {
+		return err
+	}
+
+	current, _ := s.config()
+	for _, setting := range keepStartSettings(current.Core, &cfg.Core) {
+		s.Log(debug.LogNone, fmt.Errorf("%s: %s changed and takes effect after a restart", s.configFile, setting))
+	}
+
+	// The new templates and routes are built off to the side, so nothing changes
+	// if they cannot be built
+	tpls, err := s.generateTemplates(cfg.Core.FileDir)
+	if err != nil {
+		return err
+	}
+
+	sr := router.NewRouter()
+	sr.WebDAV = cfg.Core.WebDAV
+	limiters, err := s.addRoutesFromConfig(sr, s.configFile, cfg, vhosts)
+	if err != nil {
+		return err
+	}
+
+	// Swap in the new configuration, templates and routes at once. Handlers read the
+	// configuration with config and hostConfig, which wait for the swap to finish.
+	s.cfgMu.Lock()
+	s.Cfg, s.Vhosts, s.templates, s.files = cfg, vhosts, tpls, files
+	s.hosts, s.limiters = vhostHosts(cfg, vhosts), limiters
+	s.Router.ReplaceRoutes(sr)
+	s.cfgMu.Unlock()
+
+	return nil
+}
+
+// keepStartSettings copies the settings of the core configuration that are only used when the
+// server starts from current to next. It returns the names of the settings that were changed in next.
+func keepStartSettings(current CoreConfig, next *CoreConfig) []string {
+
+	settings := []struct {
+		name    string
+		changed bool
+	}{
+		{"Core.Address", current.Address != next.Address},
+		{"Core.Port", current.Port != next.Port},
+		{"Core.LogLevel", current.LogLevel != next.LogLevel},
+		{"Core.LogOut", current.LogOut != next.LogOut},
+		{"Core.ReadTimeout", current.ReadTimeout != next.ReadTimeout},
+		{"Core.ReadHeaderTimeout", current.ReadHeaderTimeout != next.ReadHeaderTimeout},
+		{"Core.WriteTimeout", current.WriteTimeout != next.WriteTimeout},
+		{"Core.ReloadInterval", current.ReloadInterval != next.ReloadInterval},
+		{"Core.TLS", !reflect.DeepEqual(current.TLS, next.TLS)},
+		{"Core.Metrics.Enabled", current.Metrics.Enabled != next.Metrics.Enabled},
+		{"Core.Metrics.Out", current.Metrics.Out != next.Metrics.Out},
+	}
+
+	var changed []string
+	for _, setting := range settings {
+		if setting.changed {
+			changed = append(changed, setting.name)
+		}
+	}
+
+	next.Address, next.Port = current.Address, current.Port
+	next.LogLevel, next.LogOut = current.LogLevel, current.LogOut
+	next.ReadTimeout, next.ReadHeaderTimeout, next.WriteTimeout = current.ReadTimeout, current.ReadHeaderTimeout, current.WriteTimeout
+	next.ReloadInterval = current.ReloadInterval
+	next.TLS = current.TLS
+	next.Metrics.Enabled, next.Metrics.Out = current.Metrics.Enabled, current.Metrics.Out
+
+	return changed
+}
+
+// fileStamp identifies a version of a watched configuration file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// configStamps returns the stamps of the files the configuration was loaded from, including the
+// configuration files of the vhosts, included files and secret files. Files that cannot be read
+// are left out, so removing or recreating a file is noticed as a change.
+func (s *Server) configStamps() map[string]fileStamp {
+
+	s.cfgMu.RLock()
+	files := append([]string{s.configFile}, s.files...)
+	s.cfgMu.RUnlock()
+
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil {
+			stamps[file] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+
+	return stamps
+}
+
+// sameStamps reports whether the watched configuration files are unchanged
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, stamp := range a {
+		if other, ok := b[file]; !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
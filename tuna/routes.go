@@ -15,183 +15,206 @@
 package tuna
 
 import (
+	"net/http"
 	"strings"
 
+	"github.com/redmaner/MaguroHTTP/cache"
 	"github.com/redmaner/MaguroHTTP/guard"
 	"github.com/redmaner/MaguroHTTP/router"
 )
 
-func (s *Server) addRoutesFromConfig() {
+// addRoutesFromConfig adds the routes of configuration cfg and the vhost configurations to router sr.
+// It returns the limiters of the hosts by host. p is the path of the configuration file, which is
+// used in the returned *ConfigError.
+func (s *Server) addRoutesFromConfig(sr *router.SRouter, p string, cfg Config, vhosts map[string]Config) (map[string]*guard.Limiter, error) {
 
-	var limiter *guard.Limiter
-	var firewall *guard.Firewall
+	limiters := make(map[string]*guard.Limiter)
+
+	// Custom methods, like PURGE, are registered in the router before the routes using them
+	for _, mtd := range cfg.Core.Methods {
+		if err := sr.TryRegisterMethod(mtd); err != nil {
+			return nil, &ConfigError{File: p, Field: "Core.Methods", Err: err}
+		}
+	}
 
 	// Make routes for each vhost, if vhosts are enabled
-	if s.Cfg.Core.VirtualHosting {
+	if cfg.Core.VirtualHosting {
 
 		// Loop over each Vhost
-		for vhost := range s.Cfg.Core.VirtualHosts {
-
-			// Each virtual host gets it's own limiter
-			limiter = guard.NewLimiter(s.Vhosts[vhost].Guard.Rate, s.Vhosts[vhost].Guard.RateBurst, s.Vhosts[vhost].Guard.FilterOnIP)
-			limiter.ErrorHandler = s.HandleError
-
-			if s.Vhosts[vhost].Guard.Firewall.Enabled {
-				firewall = &guard.Firewall{
-					Blacklisting: s.Vhosts[vhost].Guard.Firewall.Blacklisting,
-					Subpath:      s.Vhosts[vhost].Guard.Firewall.Subpath,
-					Rules:        s.Vhosts[vhost].Guard.Firewall.Rules,
-					ErrorHandler: s.HandleError,
-				}
+		for vhost, file := range cfg.Core.VirtualHosts {
+			if err := s.addRoutesForHost(sr, vhost, file, vhosts[vhost], limiters); err != nil {
+				return nil, err
 			}
+		}
+	} else if err := s.addRoutesForHost(sr, router.DefaultHost, p, cfg, limiters); err != nil {
+		return nil, err
+	}
 
-			// Start with proxy
-			if s.Vhosts[vhost].Proxy.Enabled {
-				for host := range s.Vhosts[vhost].Proxy.Rules {
-					for _, mtd := range s.Vhosts[vhost].Proxy.Methods {
-						s.Router.AddRoute(host, "/", true, mtd, "*", s.handleProxy())
-					}
+	if cfg.Core.Metrics.Enabled {
 
-					// Add firewall as middleware if enabled
-					if s.Vhosts[vhost].Guard.Firewall.Enabled {
-						s.Router.UseMiddleware(host, "/", router.MiddlewareHandlerFunc(firewall.BlockProxy))
-					}
+		ba := guard.SimpleBasicAuth(cfg.Core.Metrics.Users)
+		ba.UnauthorizedHandler = s.HandleError
 
-					// Add limiter as middleware
-					s.Router.UseMiddleware(host, "/", router.MiddlewareHandlerFunc(limiter.LimitHTTP))
-				}
+		if err := sr.TryAddRoute(router.DefaultHost, cfg.Core.Metrics.Path, false, "GET", "", s.handleMetrics()); err != nil {
+			return nil, &ConfigError{File: p, Field: "Core.Metrics.Path", Err: err}
+		}
+		if err := sr.TryUseMiddleware(router.DefaultHost, cfg.Core.Metrics.Path, router.MiddlewareHandlerFunc(ba.Authenticate)); err != nil {
+			return nil, &ConfigError{File: p, Field: "Core.Metrics.Path", Err: err}
+		}
+	}
 
-			} else if s.Vhosts[vhost].Serve.Download.Enabled {
-				s.Router.AddRoute(vhost, "/", true, "GET", "", s.handleDownload())
+	return limiters, nil
+}
 
-				// Add firewall as middleware if enabled
-				if s.Vhosts[vhost].Guard.Firewall.Enabled {
-					s.Router.UseMiddleware(vhost, "/", router.MiddlewareHandlerFunc(firewall.BlockHTTP))
-				}
+// limiterCache returns a cache for a limiter that remembers clients clients. Small caches
+// get less shards, so each shard has room for a reasonable amount of clients.
+func limiterCache(clients int) *cache.SpearCache {
 
-				// Add limiter as middleware
-				s.Router.UseMiddleware(vhost, "/", router.MiddlewareHandlerFunc(limiter.LimitHTTP))
+	shards := 256
+	for shards > 1 && clients/shards < 64 {
+		shards /= 2
+	}
 
-				// Default is serve
-			} else {
+	return cache.NewCacheWithOptions(cache.Options{
+		Shards:        shards,
+		ItemsPerShard: (clients + shards - 1) / shards,
+	})
+}
 
-				// Loop over each supported method
-				for path, method := range s.Vhosts[vhost].Serve.Methods {
+// addRoutesForHost adds the routes of configuration cfg to host of router sr. The firewall
+// and limiter guard every route of the host, and the proxy rules. file is
+// the configuration file of cfg, which is used in the returned *ConfigError. The limiter of
+// the host is added to limiters.
+func (s *Server) addRoutesForHost(sr *router.SRouter, host, file string, cfg Config, limiters map[string]*guard.Limiter) error {
 
-					var fallback bool
-					contentType := ";"
+	var firewall *guard.Firewall
 
-					if path[len(path)-1] == '/' {
-						fallback = true
-					}
+	// Each host gets it's own limiter
+	limiter := guard.NewLimiter(cfg.Guard.Rate, cfg.Guard.RateBurst, cfg.Guard.FilterOnIP)
+	if cfg.Guard.Clients > 0 {
+		limiter = guard.NewLimiterWithCache(cfg.Guard.Rate, cfg.Guard.RateBurst, cfg.Guard.FilterOnIP, limiterCache(cfg.Guard.Clients))
+	}
+	limiters[host] = limiter
+	limiter.ErrorHandler = s.HandleError
+
+	if cfg.Guard.Firewall.Enabled {
+		firewall = &guard.Firewall{
+			Blacklisting: cfg.Guard.Firewall.Blacklisting,
+			Subpath:      cfg.Guard.Firewall.Subpath,
+			Rules:        cfg.Guard.Firewall.Rules,
+			ErrorHandler: s.HandleError,
+		}
+	}
 
-					// Loop over each Content-Type for given path
-					if content, ok := s.Vhosts[vhost].Serve.MIMETypes.RequestTypes[path]; ok {
-						contentType = content
-					}
+	// Start with proxy
+	if cfg.Proxy.Enabled {
+		for rule := range cfg.Proxy.Rules {
+			field := "Proxy.Rules." + rule
+			for _, mtd := range cfg.Proxy.Methods {
+				if err := sr.TryAddRoute(rule, "/", true, mtd, "*", s.handleProxy("")); err != nil {
+					return &ConfigError{File: file, Field: field, Err: err}
+				}
 
-					if strings.IndexByte(method, ';') > -1 {
-						for _, mtd := range strings.Split(method, ";") {
-							s.Router.AddRoute(vhost, path, fallback, mtd, contentType, s.handleServe())
-						}
-					} else {
-						s.Router.AddRoute(vhost, path, fallback, method, contentType, s.handleServe())
+				// Requests matching the predicates of a variant are proxied to the target of the variant
+				for _, v := range cfg.Proxy.Variants[rule] {
+					predicates, err := router.ParsePredicates(v.When)
+					if err == nil {
+						err = sr.TryAddRouteWhen(rule, "/", true, mtd, "*", s.handleProxy(v.Target), predicates...)
 					}
-
-					// Add firewall as middleware if enabled
-					if s.Vhosts[vhost].Guard.Firewall.Enabled {
-						s.Router.UseMiddleware(vhost, path, router.MiddlewareHandlerFunc(firewall.BlockHTTP))
+					if err != nil {
+						return &ConfigError{File: file, Field: "Proxy.Variants." + rule, Err: err}
 					}
-
-					// Add limiter as middleware
-					s.Router.UseMiddleware(vhost, path, router.MiddlewareHandlerFunc(limiter.LimitHTTP))
 				}
 			}
-		}
-	} else {
-
-		limiter = guard.NewLimiter(s.Cfg.Guard.Rate, s.Cfg.Guard.RateBurst, s.Cfg.Guard.FilterOnIP)
-		limiter.ErrorHandler = s.HandleError
-
-		if s.Cfg.Guard.Firewall.Enabled {
-			firewall = &guard.Firewall{
-				Blacklisting: s.Cfg.Guard.Firewall.Blacklisting,
-				Subpath:      s.Cfg.Guard.Firewall.Subpath,
-				Rules:        s.Cfg.Guard.Firewall.Rules,
-				ErrorHandler: s.HandleError,
-			}
-		}
-
-		// Start with proxy
-		if s.Cfg.Proxy.Enabled {
-			for host := range s.Cfg.Proxy.Rules {
-				for _, mtd := range s.Cfg.Proxy.Methods {
-					s.Router.AddRoute(host, "/", true, mtd, "*", s.handleProxy())
-				}
 
-				// Add firewall as middleware if enabled
-				if s.Cfg.Guard.Firewall.Enabled {
-					s.Router.UseMiddleware(host, "/", router.MiddlewareHandlerFunc(firewall.BlockProxy))
+			// Add firewall as middleware if enabled
+			if cfg.Guard.Firewall.Enabled {
+				if err := sr.TryUseHostMiddleware(rule, router.MiddlewareHandlerFunc(firewall.BlockProxy)); err != nil {
+					return &ConfigError{File: file, Field: field, Err: err}
 				}
-
-				// Add limiter as middleware
-				s.Router.UseMiddleware(host, "/", router.MiddlewareHandlerFunc(limiter.LimitHTTP))
 			}
 
-		} else if s.Cfg.Serve.Download.Enabled {
-			s.Router.AddRoute(router.DefaultHost, "/", true, "GET", "", s.handleDownload())
-
-			// Add firewall as middleware if enabled
-			if s.Cfg.Guard.Firewall.Enabled {
-				s.Router.UseMiddleware(router.DefaultHost, "/", router.MiddlewareHandlerFunc(firewall.BlockHTTP))
+			// Add limiter as middleware
+			if err := sr.TryUseHostMiddleware(rule, router.MiddlewareHandlerFunc(limiter.LimitHTTP)); err != nil {
+				return &ConfigError{File: file, Field: field, Err: err}
 			}
+		}
+		return nil
+	}
 
-			// Add limiter as middleware
-			s.Router.UseMiddleware(router.DefaultHost, "/", router.MiddlewareHandlerFunc(limiter.LimitHTTP))
+	// The firewall and limiter guard every route of the host. Without virtual hosting the host is
+	// DefaultHost, which also serves the metrics page. The metrics page is protected by basic auth
+	// instead, so it stays reachable when clients are limited or blocked.
+	guards := []router.Middleware{router.MiddlewareHandlerFunc(limiter.LimitHTTP)}
+	if cfg.Guard.Firewall.Enabled {
+		guards = append([]router.Middleware{router.MiddlewareHandlerFunc(firewall.BlockHTTP)}, guards...)
+	}
+	for _, g := range guards {
+		if host == router.DefaultHost && cfg.Core.Metrics.Enabled {
+			g = exemptPath(g, cfg.Core.Metrics.Path)
+		}
+		if err := sr.TryUseHostMiddleware(host, g); err != nil {
+			return &ConfigError{File: file, Field: "Guard", Err: err}
+		}
+	}
 
-			// Default is serve
-		} else {
-			// Normal serve is enabled
-			// Loop over each supported method
-			for path, method := range s.Cfg.Serve.Methods {
+	if cfg.Serve.Download.Enabled {
+		if err := sr.TryAddRoute(host, "/", true, "GET", "", s.handleDownload()); err != nil {
+			return &ConfigError{File: file, Field: "Serve.Download", Err: err}
+		}
+		return nil
+	}
 
-				var fallback bool
-				contentType := ";"
+	// Default is serve
+	// Loop over each supported method
+	for path, method := range cfg.Serve.Methods {
 
-				if path[len(path)-1] == '/' {
-					fallback = true
-				}
+		var fallback bool
+		contentType := ";"
 
-				// Loop over each Content-Type for given path
-				if content, ok := s.Cfg.Serve.MIMETypes.RequestTypes[path]; ok {
-					contentType = content
-				}
+		if path[len(path)-1] == '/' {
+			fallback = true
+		}
 
-				if strings.IndexByte(method, ';') > -1 {
-					for _, mtd := range strings.Split(method, ";") {
-						s.Router.AddRoute(router.DefaultHost, path, fallback, mtd, contentType, s.handleServe())
-					}
-				} else {
-					s.Router.AddRoute(router.DefaultHost, path, fallback, method, contentType, s.handleServe())
-				}
+		// Loop over each Content-Type for given path
+		if content, ok := cfg.Serve.MIMETypes.RequestTypes[path]; ok {
+			contentType = content
+		}
 
-				// Add firewall as middleware if enabled
-				if s.Cfg.Guard.Firewall.Enabled {
-					s.Router.UseMiddleware(router.DefaultHost, path, router.MiddlewareHandlerFunc(firewall.BlockHTTP))
-				}
+		field := "Serve.Methods." + path
+		predicates, err := router.ParsePredicates(cfg.Serve.Predicates[path])
+		if err != nil {
+			return &ConfigError{File: file, Field: "Serve.Predicates." + path, Err: err}
+		}
 
-				// Add limiter as middleware
-				s.Router.UseMiddleware(router.DefaultHost, path, router.MiddlewareHandlerFunc(limiter.LimitHTTP))
+		for _, mtd := range strings.Split(method, ";") {
+			if len(predicates) > 0 {
+				err = sr.TryAddRouteWhen(host, path, fallback, mtd, contentType, s.handleServe(), predicates...)
+			} else {
+				err = sr.TryAddRoute(host, path, fallback, mtd, contentType, s.handleServe())
+			}
+			if err != nil {
+				return &ConfigError{File: file, Field: field, Err: err}
 			}
 		}
 	}
 
-	if s.Cfg.Core.Metrics.Enabled {
-
-		ba := guard.SimpleBasicAuth(s.Cfg.Core.Metrics.Users)
-		ba.UnauthorizedHandler = s.HandleError
+	return nil
+}
 
-		s.Router.AddRoute(router.DefaultHost, s.Cfg.Core.Metrics.Path, false, "GET", "", s.handleMetrics())
-		s.Router.UseMiddleware(router.DefaultHost, s.Cfg.Core.Metrics.Path, router.MiddlewareHandlerFunc(ba.Authenticate))
-	}
+// exemptPath returns middleware m, which is skipped for requests of path. The router sets the request
+// path to the path of the matched route before middleware runs, so the path is compared as is.
+func exemptPath(m router.Middleware, path string) router.Middleware {
+
+	path = strings.TrimSuffix(path, "/")
+	return router.MiddlewareHandler(func(h http.Handler) http.Handler {
+		guarded := m.MiddlewareHTTP(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.TrimSuffix(r.URL.Path, "/") == path {
+				h.ServeHTTP(w, r)
+				return
+			}
+			guarded.ServeHTTP(w, r)
+		})
+	})
 }
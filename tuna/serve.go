@@ -17,6 +17,8 @@ package tuna
 import (
 	"context"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -27,17 +29,51 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 )
 
-// Serve is used to serve a MaguroHTTP instance
+// shutdownTimeout is the time connections get to finish when the server is stopped
+// by a signal or by the cancellation of the context passed to Start
+const shutdownTimeout = 30 * time.Second
+
+// Serve is used to serve a MaguroHTTP instance. It stops the server gracefully on SIGINT and
+// SIGTERM, unless other signals are set with WithSignals, and returns when the server has stopped.
+// It calls log.Fatal if the server cannot be started or stops with an error.
 func (s *Server) Serve() {
 
+	if len(s.signals) == 0 {
+		s.signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	<-s.Done()
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Start starts serving the MaguroHTTP instance in the background. It returns an error if the
+// server was started before, or if it cannot listen on the address of the configuration.
+// The server is stopped gracefully when ctx is cancelled, when Shutdown is called or when
+// one of the signals set with WithSignals is received. Done is closed when the server has stopped.
+func (s *Server) Start(ctx context.Context) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.httpServer != nil {
+		return ErrServerStarted
+	}
+
 	// TLS
 	var tlsCert string
 	var tlsKey string
+	useTLS := s.Cfg.Core.TLS.Enabled && s.httpCheckTLS()
 
 	// Define server struct
-	server := http.Server{
+	server := &http.Server{
 		Addr:              s.Cfg.Core.Address + ":" + s.Cfg.Core.Port,
-		Handler:           s.Router,
+		Handler:           s,
 		ReadTimeout:       time.Duration(s.Cfg.Core.ReadTimeout) * time.Second,
 		ReadHeaderTimeout: time.Duration(s.Cfg.Core.ReadHeaderTimeout) * time.Second,
 		WriteTimeout:      time.Duration(s.Cfg.Core.WriteTimeout) * time.Second,
@@ -45,38 +81,8 @@ func (s *Server) Serve() {
 		ErrorLog:          s.logInterface.Instance,
 	}
 
-	go func() {
-		// Gracefully stop the server in case of a signal
-		sig := make(chan os.Signal)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		for {
-			select {
-			case signal := <-sig:
-				fmt.Printf("Signal (%d) received, stopping\n", signal)
-
-				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				defer cancel()
-
-				// Flush metrics on server stop
-				if s.Cfg.Core.Metrics.Enabled {
-					s.flushMetrics()
-				}
-
-				server.SetKeepAlivesEnabled(false)
-				if err := server.Shutdown(ctx); err != nil {
-					s.Log(debug.LogNone, fmt.Errorf("could not gracefully shutdown the server: %v", err))
-				}
-				close(sig)
-				os.Exit(1)
-			}
-		}
-	}()
-
-	switch {
-
 	// If TLS is enabled the server will start in TLS
-	case s.Cfg.Core.TLS.Enabled && s.httpCheckTLS():
-		s.Log(debug.LogNone, fmt.Errorf("MaguroHTTP %s is listening on port %s with TLS", Version, s.Cfg.Core.Port))
+	if useTLS {
 		tlsc := s.httpCreateTLSConfig()
 
 		// Handle autocert
@@ -92,18 +98,175 @@ func (s *Server) Serve() {
 			tlsKey = s.Cfg.Core.TLS.TLSKey
 		}
 		server.TLSConfig = tlsc
+	}
 
-		err := server.ListenAndServeTLS(tlsCert, tlsKey)
+	// Listen on the configured address, unless a listener is set with WithListener
+	if s.listener == nil {
+		l, err := net.Listen("tcp", server.Addr)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		s.listener = l
+	}
+	s.httpServer = server
 
-	// if TLS is not enabled HTTP will be served
-	default:
-		s.Log(debug.LogNone, fmt.Errorf("MaguroHTTP %s is listening on port %s", Version, s.Cfg.Core.Port))
-		err := server.ListenAndServe()
-		if err != nil {
-			panic(err)
+	// Handle metrics
+	s.loadMetrics()
+	go s.metricsDaemon()
+
+	serveErr := make(chan error, 1)
+	go func(l net.Listener) {
+		if useTLS {
+			s.Log(debug.LogNone, fmt.Errorf("MaguroHTTP %s is listening on %s with TLS", Version, l.Addr()))
+			serveErr <- server.ServeTLS(l, tlsCert, tlsKey)
+			return
 		}
+
+		// if TLS is not enabled HTTP will be served
+		s.Log(debug.LogNone, fmt.Errorf("MaguroHTTP %s is listening on %s", Version, l.Addr()))
+		serveErr <- server.Serve(l)
+	}(s.listener)
+
+	go s.watch(ctx, serveErr)
+
+	return nil
+}
+
+// watch stops the server when ctx is cancelled, a signal is received or the server
+// stops serving because of an error. It returns when the server is stopped. Until then
+// it reloads the configuration on reload signals, and when the configuration files change
+// if ReloadInterval is set.
+func (s *Server) watch(ctx context.Context, serveErr <-chan error) {
+
+	// A nil channel blocks forever, so signals are only handled when they are set
+	var sig, reload chan os.Signal
+	if len(s.signals) > 0 {
+		sig = make(chan os.Signal, 1)
+		signal.Notify(sig, s.signals...)
+		defer signal.Stop(sig)
+	}
+	if len(s.reloadSignals) > 0 {
+		reload = make(chan os.Signal, 1)
+		signal.Notify(reload, s.reloadSignals...)
+		defer signal.Stop(reload)
+	}
+
+	// Poll the configuration files for changes
+	var poll <-chan time.Time
+	cfg, _ := s.config()
+	if cfg.Core.ReloadInterval > 0 && s.configFile != "" {
+		ticker := time.NewTicker(time.Duration(cfg.Core.ReloadInterval) * time.Second)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	stamps := s.configStamps()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			s.stopWithTimeout(nil)
+			return
+		case received := <-sig:
+			s.Log(debug.LogNone, fmt.Errorf("Signal (%v) received, stopping", received))
+			s.stopWithTimeout(nil)
+			return
+		case err := <-serveErr:
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			s.stopWithTimeout(err)
+			return
+		case received := <-reload:
+			s.Log(debug.LogNone, fmt.Errorf("Signal (%v) received, reloading configuration", received))
+			s.Reload()
+			stamps = s.configStamps()
+		case <-poll:
+			if sameStamps(stamps, s.configStamps()) {
+				continue
+			}
+			s.Log(debug.LogNone, fmt.Errorf("Configuration files changed, reloading configuration"))
+			s.Reload()
+
+			// A failed reload is not retried until the files change again
+			stamps = s.configStamps()
+		}
+	}
+}
+
+// stopWithTimeout stops the server, giving connections shutdownTimeout to finish
+func (s *Server) stopWithTimeout(cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.shutdown(ctx, cause); err != nil {
+		s.Log(debug.LogNone, fmt.Errorf("could not gracefully shutdown the server: %v", err))
+	}
+}
+
+// Shutdown gracefully stops the server. It waits for active connections to finish until ctx
+// is done, in which case the error of ctx is returned. Metrics are flushed when the server
+// has stopped. Calling Shutdown on a stopped server has no effect.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	s.mu.Lock()
+	started := s.httpServer != nil
+	s.mu.Unlock()
+
+	if !started {
+		return ErrServerNotStarted
+	}
+	return s.shutdown(ctx, nil)
+}
+
+// shutdown stops the started server once, and records cause as the error of the server
+func (s *Server) shutdown(ctx context.Context, cause error) error {
+
+	var err error
+	s.stopOnce.Do(func() {
+		close(s.stop)
+
+		s.httpServer.SetKeepAlivesEnabled(false)
+		err = s.httpServer.Shutdown(ctx)
+
+		// Flush metrics on server stop
+		if cfg, _ := s.config(); cfg.Core.Metrics.Enabled {
+			s.flushMetrics()
+		}
+
+		s.err = cause
+		close(s.done)
+	})
+
+	<-s.done
+	return err
+}
+
+// Done returns a channel that is closed when the server has stopped
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that made the server stop, or nil if the server was stopped
+// by Shutdown, a signal or the cancellation of the context passed to Start.
+// It should be called after Done is closed.
+func (s *Server) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Addr returns the address the server is listening on, or nil if the server isn't started
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.httpServer == nil {
+		return nil
 	}
+	return s.listener.Addr()
 }
@@ -15,7 +15,6 @@
 package tuna
 
 import (
-	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
@@ -23,8 +22,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/hashicorp/hcl"
+	"github.com/redmaner/MaguroHTTP/cache"
 	"github.com/redmaner/MaguroHTTP/debug"
+	"github.com/redmaner/MaguroHTTP/guard"
 	"github.com/redmaner/MaguroHTTP/router"
 )
 
@@ -54,143 +54,265 @@ type Server struct {
 
 	// Tpls
 	templates templates
+
+	// Options of New
+	configFile    string
+	listener      net.Listener
+	signals       []os.Signal
+	reloadSignals []os.Signal
+
+	// Configuration, vhosts and templates are replaced under cfgMu when the
+	// configuration is reloaded. reloadMu makes sure one reload runs at a time.
+	cfgMu    sync.RWMutex
+	reloadMu sync.Mutex
+
+	// files holds the files the configuration was loaded from, which are watched for changes
+	files []string
+
+	// hosts holds the vhost of each host and alias, see vhostHosts
+	hosts map[string]string
+
+	// limiters holds the limiter of each host, to report their statistics
+	limiters map[string]*guard.Limiter
+
+	// downloads caches the lists of downloadable files, see handleDownload
+	downloads *cache.SpearCache
+
+	// Lifecycle of the server, see Start and Shutdown
+	httpServer *http.Server
+	stopOnce   sync.Once
+	stop       chan struct{}
+	done       chan struct{}
+	err        error
 }
 
-// NewInstance returns a pointer to a new MaguroHTTP server based on supplied config
+// New returns a new MaguroHTTP server configured by opts. The configuration is validated,
+// and the templates and routes are added, so the server is ready to be started with Start.
+// Without WithConfigFile or WithConfig the default configuration of NewConfig is used.
+func New(opts ...Option) (*Server, error) {
+
+	s := newServer(NewConfig(), nil)
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Load the configuration and the configurations of the vhosts
+	var err error
+	if s.configFile != "" {
+		s.Cfg, s.Vhosts, s.files, err = loadConfig(s.configFile)
+	} else if err = s.Cfg.TryValidate("", false); err == nil {
+		s.Vhosts, s.files, err = loadVhosts(s.Cfg, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.hosts = vhostHosts(s.Cfg, s.Vhosts)
+
+	// init the Logger
+	if s.logInterface == nil {
+		s.logInterface, err = debug.NewLogger(s.Cfg.Core.LogLevel, "MaguroHTTP-", s.Cfg.Core.LogOut)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate the necessary templates
+	if s.templates, err = s.generateTemplates(s.Cfg.Core.FileDir); err != nil {
+		return nil, err
+	}
+
+	// Add routing to the server
+	s.Router.ErrorHandler = s.HandleError
+	s.Router.WebDAV = s.Cfg.Core.WebDAV
+	if s.limiters, err = s.addRoutesFromConfig(s.Router, s.configFile, s.Cfg, s.Vhosts); err != nil {
+		return nil, err
+	}
+
+	// Define http transport
+	if s.Transport == nil {
+		s.Transport = newTransport(s.Cfg.Core)
+	}
+
+	return s, nil
+}
+
+// newServer returns a server with configuration cfg and vhost configurations vhosts,
+// that isn't started yet
+func newServer(cfg Config, vhosts map[string]Config) *Server {
+	return &Server{
+		Cfg:    cfg,
+		Vhosts: vhosts,
+		hosts:  vhostHosts(cfg, vhosts),
+		Router: router.NewRouter(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+
+		// The lists are small and there are few of them, failing walks are retried after a second
+		downloads: cache.NewCacheWithOptions(cache.Options{Shards: 1, ItemsPerShard: 64, ErrorTTL: time.Second}),
+	}
+}
+
+// NewInstance returns a pointer to a new MaguroHTTP server based on supplied config.
+// The routes of the configuration are not added, use New to create a server that is ready to serve.
+// It calls log.Fatal on errors, use TryNewInstance to handle the error instead.
 func NewInstance(c CoreConfig) *Server {
+	s, err := TryNewInstance(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
+
+// TryNewInstance is like NewInstance, but returns an error if a vhost configuration
+// cannot be loaded or the logger or templates cannot be initialised
+func TryNewInstance(c CoreConfig) (*Server, error) {
 
 	cfg := NewConfig()
 	cfg.Core = c
 	cfg.Core.Metrics.Enabled = false
 
 	// vhost configigurations
-	vhosts := make(map[string]Config)
-
-	// If virtual hosting is enabled, all the configurations of the vhosts are loaded
-	if cfg.Core.VirtualHosting {
-		for k, v := range cfg.Core.VirtualHosts {
-			vcfg := NewVhostConfig()
-			LoadConfigFromFile(v, &vcfg)
-			vcfg.Validate(v, true)
-			vhosts[k] = vcfg
-		}
+	vhosts, _, err := loadVhosts(cfg, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	// init the Logger
 	logger, err := debug.NewLogger(cfg.Core.LogLevel, "MaguroHTTP-", cfg.Core.LogOut)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	mux := router.NewRouter()
-
-	s := Server{
-		Cfg:          cfg,
-		Vhosts:       vhosts,
-		Router:       mux,
-		logInterface: logger,
-	}
+	s := newServer(cfg, vhosts)
+	s.logInterface = logger
 
 	// Generate the necessary templates
-	s.generateTemplates()
+	if s.templates, err = s.generateTemplates(s.Cfg.Core.FileDir); err != nil {
+		return nil, err
+	}
 
 	// Add routing to the server
 	s.Router.ErrorHandler = s.HandleError
 	s.Router.WebDAV = s.Cfg.Core.WebDAV
 
 	// Define http transport
-	s.Transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   60 * time.Second,
-			KeepAlive: 60 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       60 * time.Second,
-		TLSHandshakeTimeout:   8 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		ResponseHeaderTimeout: time.Duration(s.Cfg.Core.ReadHeaderTimeout) * time.Second,
-	}
+	s.Transport = newTransport(s.Cfg.Core)
 
-	return &s
+	return s, nil
 }
 
-// NewInstanceFromConfig will create a new instance from a config file
+// NewInstanceFromConfig will create a new instance from a config file.
+// It calls log.Fatal on errors, use TryNewInstanceFromConfig to handle the error instead.
 func NewInstanceFromConfig(p string) *Server {
-
-	// vhost configigurations
-	vhosts := make(map[string]Config)
-
-	// Initialise empty config
-	cfg := NewConfig()
-
-	// check if config exists
-	if _, err := os.Stat(p); err != nil {
+	s, err := TryNewInstanceFromConfig(p)
+	if err != nil {
 		log.Fatal(err)
 	}
+	return s
+}
 
-	// load config
-	file, err := os.Open(p)
+// TryNewInstanceFromConfig is like NewInstanceFromConfig, but returns an error if the
+// configuration is invalid or the server cannot be initialised. Errors concerning the
+// configuration are of type *ConfigError. It is equal to New(WithConfigFile(p)).
+func TryNewInstanceFromConfig(p string) (*Server, error) {
+	return New(WithConfigFile(p))
+}
+
+// NewRouterFromConfig returns the router MaguroHTTP would use to serve the config file,
+// without initialising logging, templates and metrics. This can be used to inspect the routes
+// of a configuration with router.SRouter.Routes and router.SRouter.Explain.
+// It calls log.Fatal on errors, use TryNewRouterFromConfig to handle the error instead.
+func NewRouterFromConfig(p string) *router.SRouter {
+	sr, err := TryNewRouterFromConfig(p)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return sr
+}
+
+// TryNewRouterFromConfig is like NewRouterFromConfig, but returns a *ConfigError if the
+// configuration is invalid
+func TryNewRouterFromConfig(p string) (*router.SRouter, error) {
 
-	data, err := ioutil.ReadAll(file)
+	cfg, vhosts, _, err := loadConfig(p)
 	if err != nil {
-		log.Fatalf("%s: %v", p, err)
+		return nil, err
 	}
-	err = file.Close()
-	if err != nil {
-		log.Fatal(err)
+
+	s := newServer(cfg, vhosts)
+	s.Router.WebDAV = s.Cfg.Core.WebDAV
+	if _, err := s.addRoutesFromConfig(s.Router, p, s.Cfg, s.Vhosts); err != nil {
+		return nil, err
 	}
 
-	err = hcl.Unmarshal(data, &cfg)
+	return s.Router, nil
+}
+
+// loadConfig loads and validates the config file and the configurations of the vhosts.
+// It also returns the files the configurations were loaded from.
+func loadConfig(p string) (Config, map[string]Config, []string, error) {
+
+	// Initialise empty config
+	cfg := NewConfig()
+
+	// load config
+	inline, files, err := loadConfigFile(p, &cfg)
 	if err != nil {
-		log.Fatalf("%s: %v", p, err)
+		return cfg, nil, files, err
+	}
+	if err := addInlineVhosts(p, &cfg, inline); err != nil {
+		return cfg, nil, files, err
 	}
 
 	// Validate the configuration
-	cfg.Validate(p, false)
-
-	// If virtual hosting is enabled, all the configurations of the vhosts are loaded
-	if cfg.Core.VirtualHosting {
-		for k, v := range cfg.Core.VirtualHosts {
-			vcfg := NewVhostConfig()
-			LoadConfigFromFile(v, &vcfg)
-			vcfg.Validate(v, true)
-			vhosts[k] = vcfg
-		}
+	if err := cfg.TryValidate(p, false); err != nil {
+		return cfg, nil, files, err
 	}
 
-	// init the Logger
-	lg, err := debug.NewLogger(cfg.Core.LogLevel, "MaguroHTTP-", cfg.Core.LogOut)
-	if err != nil {
-		log.Fatal(err)
-	}
+	vhosts, vhostFiles, err := loadVhosts(cfg, inline)
+	return cfg, vhosts, append(files, vhostFiles...), err
+}
+
+// loadVhosts loads and validates the configurations of the vhosts of cfg, declared in vhost files
+// or inline, if virtual hosting is enabled. It also returns the files the configurations were loaded from.
+func loadVhosts(cfg Config, inline map[string]inlineVhost) (map[string]Config, []string, error) {
 
-	mux := router.NewRouter()
+	// vhost configigurations
+	vhosts := make(map[string]Config)
 
-	s := Server{
-		Cfg:          cfg,
-		Vhosts:       vhosts,
-		Router:       mux,
-		logInterface: lg,
+	if !cfg.Core.VirtualHosting {
+		return vhosts, nil, nil
 	}
 
-	// Generate the necessary templates
-	s.generateTemplates()
+	var files []string
+	for k, v := range cfg.Core.VirtualHosts {
+		vcfg, vhostFiles, err := loadVhost(k, cfg, inline)
+		files = append(files, vhostFiles...)
+		if err != nil {
+			return nil, files, err
+		}
 
-	// Add routing to the server
-	s.Router.ErrorHandler = s.HandleError
-	s.Router.WebDAV = s.Cfg.Core.WebDAV
-	s.addRoutesFromConfig()
+		var r Report
+		_, isInline := inline[k]
+		validateVhost(k, v, &vcfg, cfg.Core, isInline, &r)
+		if len(r.Errors) > 0 {
+			return nil, files, r.Errors[0]
+		}
+		vhosts[k] = vcfg
+	}
 
-	// Handle metrics
-	go s.metricsDaemon()
+	var r Report
+	checkAliases(cfg, vhosts, inline, &r)
+	if len(r.Errors) > 0 {
+		return nil, files, r.Errors[0]
+	}
 
-	// Define http transport
-	s.Transport = &http.Transport{
+	return vhosts, files, nil
+}
+
+// newTransport returns the http transport used to proxy requests
+func newTransport(c CoreConfig) *http.Transport {
+	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   60 * time.Second,
@@ -201,8 +323,6 @@ func NewInstanceFromConfig(p string) *Server {
 		IdleConnTimeout:       60 * time.Second,
 		TLSHandshakeTimeout:   8 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-		ResponseHeaderTimeout: time.Duration(s.Cfg.Core.ReadHeaderTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(c.ReadHeaderTimeout) * time.Second,
 	}
-
-	return &s
 }
@@ -36,9 +36,12 @@ type templates struct {
 	download *html.TemplateHandler
 }
 
-func (s *Server) generateTemplates() {
+// generateTemplates creates the templates in fileDir if they don't exist yet, and parses them.
+// It returns a *html.TemplateError if a template cannot be parsed.
+func (s *Server) generateTemplates(fileDir string) (templates, error) {
 
-	tplDir := s.Cfg.Core.FileDir + "templates/"
+	var tpls templates
+	tplDir := fileDir + "templates/"
 
 	err := os.MkdirAll(tplDir, os.ModePerm)
 	s.Log(debug.LogError, err)
@@ -57,8 +60,10 @@ func (s *Server) generateTemplates() {
 	}
 
 	// Init error template
-	s.templates.error = html.NewTemplate(tplDir, "error.html")
-	s.templates.error.Init()
+	tpls.error = html.NewTemplate(tplDir, "error.html")
+	if err := tpls.error.TryInit(); err != nil {
+		return tpls, err
+	}
 
 	// Create download template when it doesn't exist yet
 	if _, err := os.Stat(tplDir + "download.html"); err != nil {
@@ -74,7 +79,10 @@ func (s *Server) generateTemplates() {
 	}
 
 	// Init download template
-	s.templates.download = html.NewTemplate(tplDir, "download.html")
-	s.templates.download.Init()
+	tpls.download = html.NewTemplate(tplDir, "download.html")
+	if err := tpls.download.TryInit(); err != nil {
+		return tpls, err
+	}
 
+	return tpls, nil
 }
@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 
 	"github.com/redmaner/MaguroHTTP/debug"
+	"github.com/redmaner/MaguroHTTP/router"
 )
 
 // Function to set headers defined in configuration
@@ -41,12 +42,13 @@ func (s *Server) setHeaders(w http.ResponseWriter, h map[string]string, isProxy
 
 	// If TLS is enabled, the Strict-Transport-Security header is set
 	// These settings can be set in the configuration
-	if s.Cfg.Core.TLS.Enabled {
-		hstr := fmt.Sprintf("max-age=%d;", s.Cfg.Core.TLS.HSTS.MaxAge)
-		if s.Cfg.Core.TLS.HSTS.IncludeSubdomains {
+	cfg, _ := s.config()
+	if cfg.Core.TLS.Enabled {
+		hstr := fmt.Sprintf("max-age=%d;", cfg.Core.TLS.HSTS.MaxAge)
+		if cfg.Core.TLS.HSTS.IncludeSubdomains {
 			hstr = hstr + " includeSubdomains;"
 		}
-		if s.Cfg.Core.TLS.HSTS.Preload {
+		if cfg.Core.TLS.HSTS.Preload {
 			hstr = hstr + " preload"
 		}
 		w.Header().Set("Strict-Transport-Security", hstr)
@@ -111,6 +113,24 @@ func getMIMEType(p string, cts MIMETypes) string {
 	return "application/octet-stream"
 }
 
+// Function to find the key of m that matches host. Keys can be host names or host patterns,
+// exact host names take precedence over host patterns.
+func matchHost(m map[string]string, host string) (string, bool) {
+
+	if _, ok := m[host]; ok {
+		return host, true
+	}
+
+	var match string
+	for k := range m {
+		if router.IsHostPattern(k) && router.MatchHost(k, host) && (match == "" || router.HostPrecedes(k, match)) {
+			match = k
+		}
+	}
+
+	return match, match != ""
+}
+
 // Copy HTTP header to an existing HTTP header
 func copyHeader(dst, src http.Header) {
 	for k, vv := range src {
@@ -0,0 +1,306 @@
+// Copyright 2018-2019 Jake van der Putten.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tuna
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/redmaner/MaguroHTTP/router"
+)
+
+// Vhosts can be declared inline in the main configuration, instead of in a file referenced by
+// Core.VirtualHosts. Declaring a vhost inline enables virtual hosting.
+//
+//	Vhost "example.com" {
+//		Inherit = true
+//		Serve {
+//			ServeDir = "/var/www/example.com/"
+//		}
+//	}
+//
+// With Inherit, a vhost starts from the Serve, Errors, Proxy and Guard settings of the main
+// configuration and only overrides what it sets. Maps are merged, lists replace the inherited list.
+// Inherit can also be set at the top level of a vhost file.
+
+// vhostKey is the key of inline vhost blocks
+const vhostKey = "Vhost"
+
+// inheritKey is the key that makes a vhost inherit the main configuration
+const inheritKey = "Inherit"
+
+// inlineVhost is a vhost declared in a Vhost block
+type inlineVhost struct {
+
+	// file is the file the block is declared in
+	file string
+
+	// list holds the settings of the vhost
+	list *ast.ObjectList
+}
+
+// vhostSettings lists the keys of a vhost configuration, to check them
+type vhostSettings struct {
+	Inherit bool
+	Core    CoreConfig
+	Serve   serveConfig
+	Errors  map[string]string
+	Proxy   proxyConfig
+	Guard   guardConfig
+	Aliases []string
+}
+
+// addInlineVhosts adds the vhosts declared inline to the virtual hosts of c, with the file they are
+// declared in, and enables virtual hosting if there are any. p is the configuration file of c.
+func addInlineVhosts(p string, c *Config, inline map[string]inlineVhost) error {
+
+	if len(inline) == 0 {
+		return nil
+	}
+
+	if c.Core.VirtualHosts == nil {
+		c.Core.VirtualHosts = make(map[string]string)
+	}
+
+	for host, vhost := range inline {
+		if _, ok := c.Core.VirtualHosts[host]; ok {
+			return configError(p, "Core.VirtualHosts."+host, "Vhost %s is declared inline and in VirtualHosts", host)
+		}
+		c.Core.VirtualHosts[host] = vhost.file
+	}
+	c.Core.VirtualHosting = true
+
+	return nil
+}
+
+// loadVhost loads the configuration of vhost host of main configuration c, declared inline or in
+// a vhost file. It also returns the files the configuration was loaded from.
+func loadVhost(host string, c Config, inline map[string]inlineVhost) (Config, []string, error) {
+
+	if vhost, ok := inline[host]; ok {
+		vcfg, err := decodeVhost(vhost.file, vhost.list, c)
+		return vcfg, nil, vhostError(host, err)
+	}
+
+	p := c.Core.VirtualHosts[host]
+	ld := configLoader{}
+	list := ld.load(p)
+	if len(ld.errs) > 0 {
+		return Config{}, ld.files, ld.errs[0]
+	}
+	if len(ld.vhosts) > 0 {
+		return Config{}, ld.files, configError(p, vhostKey, "Vhost blocks can only be declared in the main configuration")
+	}
+
+	vcfg, err := decodeVhost(p, list, c)
+	return vcfg, ld.files, err
+}
+
+// vhostHosts returns the vhost of each host and alias of the vhosts of c. Hosts and aliases
+// can be host patterns, so the vhost of a host is looked up with matchHost.
+func vhostHosts(c Config, vhosts map[string]Config) map[string]string {
+
+	hosts := make(map[string]string, len(vhosts))
+	for vhost := range c.Core.VirtualHosts {
+		hosts[vhost] = vhost
+	}
+	for vhost := range c.Core.VirtualHosts {
+		for _, alias := range vhosts[vhost].Aliases {
+			if _, ok := hosts[alias]; !ok {
+				hosts[alias] = vhost
+			}
+		}
+	}
+
+	return hosts
+}
+
+// checkAliases adds an error to report r for each alias of the vhosts of c that is used by another
+// vhost, and for aliases of host pattern vhosts. Aliases are routed as the host of their vhost,
+// which cannot be done for a host pattern.
+func checkAliases(c Config, vhosts map[string]Config, inline map[string]inlineVhost, r *Report) {
+
+	names := make([]string, 0, len(c.Core.VirtualHosts))
+	for vhost := range c.Core.VirtualHosts {
+		names = append(names, vhost)
+	}
+	sort.Strings(names)
+
+	used := make(map[string]string, len(names))
+	for _, vhost := range names {
+		used[vhost] = vhost
+	}
+
+	for _, vhost := range names {
+		vcfg, ok := vhosts[vhost]
+		if !ok || len(vcfg.Aliases) == 0 {
+			continue
+		}
+
+		field := "Aliases"
+		if _, ok := inline[vhost]; ok {
+			field = joinField(vhostKey+"."+vhost, field)
+		}
+		p := c.Core.VirtualHosts[vhost]
+
+		if router.IsHostPattern(vhost) {
+			r.addError(configError(p, field, "Aliases cannot be used by host pattern vhost %s", vhost))
+			continue
+		}
+		for _, alias := range vcfg.Aliases {
+			if other, ok := used[alias]; ok && alias != "" {
+				r.addError(configError(p, field, "Alias %s of %s is already used by vhost %s", alias, vhost, other))
+				continue
+			}
+			used[alias] = vhost
+		}
+	}
+}
+
+// validateVhost adds every error and warning of the configuration of vhost host, declared in file p,
+// to report r. Methods are checked against core, the core configuration of the main configuration.
+// Problems of vhosts declared inline are reported under Vhost.<host>.
+func validateVhost(host, p string, c *Config, core CoreConfig, isInline bool, r *Report) {
+
+	var vr Report
+	c.validate(p, true, &vr)
+	c.checkMethods(p, core, &vr)
+
+	for _, lists := range [][2]*[]*ConfigError{{&r.Errors, &vr.Errors}, {&r.Warnings, &vr.Warnings}} {
+		for _, err := range *lists[1] {
+			if isInline {
+				err.Field = joinField(vhostKey+"."+host, err.Field)
+			}
+			*lists[0] = append(*lists[0], err)
+		}
+	}
+}
+
+// vhostError reports err of the vhost host declared inline under Vhost.<host>
+func vhostError(host string, err error) error {
+	var cerr *ConfigError
+	if err == nil || !errors.As(err, &cerr) {
+		return err
+	}
+	cerr.Field = joinField(vhostKey+"."+host, cerr.Field)
+	return cerr
+}
+
+// decodeVhost decodes the settings of the vhost in list, declared in file p. If the vhost
+// inherits, the settings are decoded on top of the settings of main configuration c.
+func decodeVhost(p string, list *ast.ObjectList, c Config) (Config, error) {
+
+	inherit := false
+	items := make([]*ast.ObjectItem, 0, len(list.Items))
+	for _, item := range list.Items {
+		if len(item.Keys) != 1 || !strings.EqualFold(item.Keys[0].Token.Value().(string), inheritKey) {
+			items = append(items, item)
+			continue
+		}
+		lit, ok := item.Val.(*ast.LiteralType)
+		if !ok || lit.Token.Type != token.BOOL {
+			return Config{}, &ConfigError{File: p, Line: item.Val.Pos().Line, Field: inheritKey, Err: errors.New("Inherit must be true or false")}
+		}
+		inherit = lit.Token.Value().(bool)
+	}
+	list = &ast.ObjectList{Items: items}
+
+	vcfg := NewVhostConfig()
+	if err := hcl.DecodeObject(&vcfg, list); err != nil {
+		return Config{}, &ConfigError{File: p, Err: err}
+	}
+	if !inherit {
+		return vcfg, nil
+	}
+
+	// Decoding appends lists to the inherited lists, so the lists the vhost sets replace them afterwards
+	merged := c.inherited()
+	if err := hcl.DecodeObject(&merged, list); err != nil {
+		return Config{}, &ConfigError{File: p, Err: err}
+	}
+	merged.replaceLists(vcfg)
+
+	return merged, nil
+}
+
+// inherited returns a copy of the settings of c a vhost inherits
+func (c Config) inherited() Config {
+
+	vcfg := NewVhostConfig()
+
+	vcfg.Serve = c.Serve
+	vcfg.Serve.Headers = copyMap(c.Serve.Headers)
+	vcfg.Serve.Methods = copyMap(c.Serve.Methods)
+	vcfg.Serve.Predicates = copyMap(c.Serve.Predicates)
+	vcfg.Serve.MIMETypes.ResponseTypes = copyMap(c.Serve.MIMETypes.ResponseTypes)
+	vcfg.Serve.MIMETypes.RequestTypes = copyMap(c.Serve.MIMETypes.RequestTypes)
+	vcfg.Serve.Download.Exts = append([]string(nil), c.Serve.Download.Exts...)
+
+	vcfg.Errors = copyMap(c.Errors)
+
+	vcfg.Proxy = c.Proxy
+	vcfg.Proxy.Rules = copyMap(c.Proxy.Rules)
+	vcfg.Proxy.Methods = append([]string(nil), c.Proxy.Methods...)
+	vcfg.Proxy.Headers = copyMap(c.Proxy.Headers)
+	if c.Proxy.Variants != nil {
+		vcfg.Proxy.Variants = make(map[string][]proxyVariant, len(c.Proxy.Variants))
+		for k, v := range c.Proxy.Variants {
+			vcfg.Proxy.Variants[k] = append([]proxyVariant(nil), v...)
+		}
+	}
+
+	vcfg.Guard = c.Guard
+	if c.Guard.Firewall.Rules != nil {
+		vcfg.Guard.Firewall.Rules = make(map[string][]string, len(c.Guard.Firewall.Rules))
+		for k, v := range c.Guard.Firewall.Rules {
+			vcfg.Guard.Firewall.Rules[k] = append([]string(nil), v...)
+		}
+	}
+
+	return vcfg
+}
+
+// replaceLists replaces the lists of c with the lists set in vhost configuration v
+func (c *Config) replaceLists(v Config) {
+
+	if v.Serve.Download.Exts != nil {
+		c.Serve.Download.Exts = v.Serve.Download.Exts
+	}
+	if v.Proxy.Methods != nil {
+		c.Proxy.Methods = v.Proxy.Methods
+	}
+	for k, variants := range v.Proxy.Variants {
+		c.Proxy.Variants[k] = variants
+	}
+	for k, rules := range v.Guard.Firewall.Rules {
+		c.Guard.Firewall.Rules[k] = rules
+	}
+}
+
+// copyMap returns a copy of m
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}